@@ -0,0 +1,149 @@
+package ghpr
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// appTokenUsername is the username GitHub expects alongside an installation token for git over HTTPS
+	appTokenUsername = "x-access-token"
+	// appJWTLifetime is how long an app JWT is valid for. GitHub permits at most 10 minutes
+	appJWTLifetime = 9 * time.Minute
+	// appTokenRefreshMargin is how long before expiry an installation token is refreshed
+	appTokenRefreshMargin = 5 * time.Minute
+)
+
+// NewAppCredentials creates Credentials which authenticate as a GitHub App installation.
+// Installation tokens are requested using a JWT signed with the app's PEM encoded private
+// key, and are refreshed automatically shortly before they expire. The Credentials may be
+// used for both git operations over HTTPS and the GitHub API
+func NewAppCredentials(appID int64, installationID int64, privateKey []byte, host Host) (Credentials, error) {
+	key, err := parseAppPrivateKey(privateKey)
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "failed to parse GitHub App private key")
+	}
+
+	client := github.NewClient(&http.Client{
+		Transport: &appTransport{appID: appID, key: key, base: http.DefaultTransport},
+	})
+	host.configureClient(client)
+
+	src := &appTokenSource{client: client, installationID: installationID}
+
+	return Credentials{
+		Username:    appTokenUsername,
+		TokenSource: oauth2.ReuseTokenSource(nil, src),
+	}, nil
+}
+
+// appTransport authenticates requests as a GitHub App, rather than an installation
+type appTransport struct {
+	appID int64
+	key   *rsa.PrivateKey
+	base  http.RoundTripper
+}
+
+func (t *appTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	jwt, err := signAppJWT(t.appID, t.key, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign GitHub App JWT")
+	}
+
+	// RoundTrippers must not modify the original request
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+jwt)
+	return t.base.RoundTrip(r)
+}
+
+// appTokenSource requests a new installation token each time it is called. It should
+// be wrapped in oauth2.ReuseTokenSource to cache tokens until they are near expiry
+type appTokenSource struct {
+	client         *github.Client
+	installationID int64
+}
+
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	req, err := s.client.NewRequest("POST", fmt.Sprintf("app/installations/%d/access_tokens", s.installationID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	token := new(github.InstallationToken)
+	_, err = s.client.Do(context.Background(), req, token)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create GitHub App installation token")
+	}
+
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		Expiry:      token.GetExpiresAt().Add(-appTokenRefreshMargin),
+	}, nil
+}
+
+// signAppJWT creates an RS256 signed JWT identifying the GitHub App
+func signAppJWT(appID int64, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]int64{
+		// Backdate the issue time to allow for clock drift
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": appID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseAppPrivateKey parses a PEM encoded RSA private key in either PKCS#1 (as
+// downloaded from GitHub) or PKCS#8 form
+func parseAppPrivateKey(privateKey []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+
+	return rsaKey, nil
+}
@@ -0,0 +1,80 @@
+package ghpr
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAppJWT(t *testing.T) {
+	key, err := parseAppPrivateKey(testPrivateKey(t))
+	assert.Nil(t, err)
+
+	// When I sign a JWT for an app
+	now := time.Unix(1600000000, 0)
+	jwt, err := signAppJWT(1234, key, now)
+	assert.Nil(t, err)
+
+	// Then it is a valid RS256 JWT
+	parts := strings.Split(jwt, ".")
+	assert.Len(t, parts, 3)
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	assert.Nil(t, err)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.Nil(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature))
+
+	// And it identifies the app
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.Nil(t, err)
+	claims := map[string]int64{}
+	assert.Nil(t, json.Unmarshal(payload, &claims))
+	assert.Equal(t, int64(1234), claims["iss"])
+	assert.Equal(t, now.Add(appJWTLifetime).Unix(), claims["exp"])
+}
+
+func TestParseAppPrivateKeyInvalid(t *testing.T) {
+	_, err := parseAppPrivateKey([]byte("not a key"))
+	assert.NotNil(t, err)
+}
+
+func TestAppCredentialsRequestInstallationToken(t *testing.T) {
+	// Given a GitHub instance which issues installation tokens
+	expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/app/installations/99/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "))
+		fmt.Fprintf(w, `{"token": "installation-token", "expires_at": "%s"}`, expiry.Format(time.RFC3339))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	host, err := NewEnterpriseHost(server.URL)
+	assert.Nil(t, err)
+
+	// When I create app credentials
+	creds, err := NewAppCredentials(1234, 99, testPrivateKey(t), host)
+	assert.Nil(t, err)
+
+	// Then an installation token is used for git authentication
+	method, err := HTTPSAuth().authMethod(creds)
+	assert.Nil(t, err)
+	assert.Equal(t, &githttp.BasicAuth{Username: "x-access-token", Password: "installation-token"}, method)
+
+	// And it is refreshed before it expires
+	token, err := creds.tokenSource().Token()
+	assert.Nil(t, err)
+	assert.True(t, expiry.Add(-appTokenRefreshMargin).Equal(token.Expiry))
+}
@@ -0,0 +1,93 @@
+package ghpr
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/pkg/errors"
+)
+
+// sshUser is the user GitHub expects for git operations over SSH
+const sshUser = "git"
+
+// GitAuth describes how clones and pushes authenticate with the remote repository.
+// The default, HTTPSAuth, uses the supplied Credentials over HTTPS
+type GitAuth interface {
+	remoteURL(host Host, owner string, name string) string
+	authMethod(creds Credentials) (transport.AuthMethod, error)
+}
+
+type httpsAuth struct {
+}
+
+// HTTPSAuth authenticates over HTTPS with the username and token from Credentials
+func HTTPSAuth() GitAuth {
+	return httpsAuth{}
+}
+
+func (a httpsAuth) remoteURL(host Host, owner string, name string) string {
+	return host.repoURL(owner, name)
+}
+
+func (a httpsAuth) authMethod(creds Credentials) (transport.AuthMethod, error) {
+	token, err := creds.tokenSource().Token()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve token")
+	}
+
+	return &http.BasicAuth{Username: creds.Username, Password: token.AccessToken}, nil
+}
+
+type sshAuth struct {
+	pemBytes        []byte
+	password        string
+	useAgent        bool
+	knownHostsFiles []string
+}
+
+// SSHKeyAuth authenticates over SSH with a PEM encoded private key, e.g. a deploy key.
+// The password may be empty if the key is not encrypted. Host keys are checked against
+// the supplied known_hosts files, or the user's known_hosts if none are supplied
+func SSHKeyAuth(pemBytes []byte, password string, knownHostsFiles ...string) GitAuth {
+	return sshAuth{pemBytes: pemBytes, password: password, knownHostsFiles: knownHostsFiles}
+}
+
+// SSHAgentAuth authenticates over SSH using the keys held by the running ssh-agent.
+// Host keys are checked against the supplied known_hosts files, or the user's
+// known_hosts if none are supplied
+func SSHAgentAuth(knownHostsFiles ...string) GitAuth {
+	return sshAuth{useAgent: true, knownHostsFiles: knownHostsFiles}
+}
+
+func (a sshAuth) remoteURL(host Host, owner string, name string) string {
+	return fmt.Sprintf("%s@%s:%s/%s.git", sshUser, host.hostname(), owner, name)
+}
+
+func (a sshAuth) authMethod(creds Credentials) (transport.AuthMethod, error) {
+	helper := ssh.HostKeyCallbackHelper{}
+	if len(a.knownHostsFiles) > 0 {
+		callback, err := ssh.NewKnownHostsCallback(a.knownHostsFiles...)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load known_hosts")
+		}
+		helper.HostKeyCallback = callback
+	}
+
+	if a.useAgent {
+		auth, err := ssh.NewSSHAgentAuth(sshUser)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to connect to ssh-agent")
+		}
+		auth.HostKeyCallbackHelper = helper
+		return auth, nil
+	}
+
+	auth, err := ssh.NewPublicKeys(sshUser, a.pemBytes, a.password)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse SSH private key")
+	}
+	auth.HostKeyCallbackHelper = helper
+	return auth, nil
+}
@@ -0,0 +1,58 @@
+package ghpr
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPrivateKey(t *testing.T) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func TestHTTPSAuth(t *testing.T) {
+	auth := HTTPSAuth()
+
+	assert.Equal(t, "https://github.com/shteou/go-ghpr", auth.remoteURL(Host{}, "shteou", "go-ghpr"))
+
+	method, err := auth.authMethod(Credentials{Username: "shteou", Token: "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, &http.BasicAuth{Username: "shteou", Password: "token"}, method)
+}
+
+func TestSSHKeyAuth(t *testing.T) {
+	auth := SSHKeyAuth(testPrivateKey(t), "")
+
+	assert.Equal(t, "git@github.com:shteou/go-ghpr.git", auth.remoteURL(Host{}, "shteou", "go-ghpr"))
+
+	method, err := auth.authMethod(Credentials{})
+	assert.Nil(t, err)
+	assert.IsType(t, &ssh.PublicKeys{}, method)
+}
+
+func TestSSHKeyAuthEnterpriseHost(t *testing.T) {
+	host, err := NewEnterpriseHost("https://github.example.com")
+	assert.Nil(t, err)
+
+	auth := SSHKeyAuth(testPrivateKey(t), "")
+	assert.Equal(t, "git@github.example.com:shteou/go-ghpr.git", auth.remoteURL(host, "shteou", "go-ghpr"))
+}
+
+func TestSSHKeyAuthInvalidKey(t *testing.T) {
+	_, err := SSHKeyAuth([]byte("not a key"), "").authMethod(Credentials{})
+	assert.NotNil(t, err)
+}
+
+func TestSSHKeyAuthMissingKnownHosts(t *testing.T) {
+	_, err := SSHKeyAuth(testPrivateKey(t), "", "/does/not/exist").authMethod(Credentials{})
+	assert.NotNil(t, err)
+}
@@ -1,45 +1,266 @@
 package ghpr
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/pkg/errors"
 )
 
+// ErrNoChanges is returned by Change.Push when the UpdateFuncs did not stage any
+// changes, so there is nothing to commit or push
+var ErrNoChanges = errors.New("update produced no changes to commit")
+
 type Change struct {
-	Branch     string
-	repo       Repo
-	updateFunc UpdateFunc
-	creds      Credentials
+	Branch string
+	// ForceUpdate replaces any existing remote branch of the same name (e.g. from a
+	// previous run) with the branch rebuilt from the cloned base. The push is a
+	// force-with-lease, so it fails if the remote branch moves, or is created, while pushing
+	ForceUpdate bool
+	// Committer, if set, is recorded as the committer of each commit (e.g. a bot identity),
+	// while the signature returned by the UpdateFunc is recorded as the author
+	Committer *object.Signature
+	// CoAuthors are credited on each commit with Co-authored-by trailers
+	CoAuthors []object.Signature
+	// SignOff adds a Signed-off-by trailer for the author to each commit, as required
+	// by projects enforcing the Developer Certificate of Origin, which checks the sign-off
+	// against the commit's author rather than its Committer
+	SignOff     bool
+	repo        Repo
+	updateFuncs []UpdateFunc
+	creds       Credentials
 }
 
 // NewChange creates a new Change object with the supplied parameters
 func NewChange(repo Repo, branch string, creds Credentials, fn UpdateFunc) Change {
+	return NewMultiCommitChange(repo, branch, creds, fn)
+}
+
+// NewMultiCommitChange creates a new Change object which applies each of the supplied
+// update functions in order, making a separate commit after each one
+func NewMultiCommitChange(repo Repo, branch string, creds Credentials, fns ...UpdateFunc) Change {
 	return Change{
-		Branch:     branch,
-		repo:       repo,
-		updateFunc: fn,
-		creds:      creds,
+		Branch:      branch,
+		repo:        repo,
+		updateFuncs: fns,
+		creds:       creds,
 	}
 }
 
-// Push the change to the remote repository. First applies your update function
-// to the supplied branch and pushes to a remote branch of the same name
+// Push the change to the remote repository, or its fork. See PushContext
 func (c *Change) Push() error {
-	headRef, err := c.repo.repo.Head()
+	return c.PushContext(context.Background())
+}
+
+// PushContext pushes the change to the remote repository. First applies your update functions
+// to the supplied branch, committing after each, and pushes to a remote branch of
+// the same name. An update function which stages no changes produces no commit.
+// If none of the update functions stage any changes, ErrNoChanges is returned and
+// nothing is pushed. Communication with the remote is aborted if the supplied
+// context is cancelled
+func (c *Change) PushContext(ctx context.Context) error {
+	return c.push(ctx, c.ForceUpdate)
+}
+
+// Rebuild recreates the change on top of the latest base branch. See RebuildContext
+func (c *Change) Rebuild() error {
+	return c.RebuildContext(context.Background())
+}
+
+// RebuildContext recreates the change on top of the latest base branch, e.g. when the
+// base branch has moved on since the change was pushed. The base branch is fetched, your
+// update functions are applied to it again and the remote branch is force updated. As
+// with PushContext, ErrNoChanges is returned if the update functions stage no changes
+func (c *Change) RebuildContext(ctx context.Context) error {
+	if c.repo.repo == nil {
+		return errors.New("repository must be cloned before the change is rebuilt")
+	}
+
+	err := c.resetToLatestBase(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to reset to latest base branch")
+	}
+
+	return c.push(ctx, true)
+}
+
+func (c *Change) push(ctx context.Context, force bool) error {
+	base, err := c.commit(true)
+	if err != nil {
+		return err
+	}
+
+	branchRef := fmt.Sprintf("refs/remotes/origin/%s", c.Branch)
+	ref := plumbing.NewHashReference(plumbing.ReferenceName(branchRef), base)
+	err = c.repo.repo.Storer.SetReference(ref)
+	if err != nil {
+		return errors.Wrap(err, "failed to set reference for remote branch")
+	}
+
+	auth, err := c.repo.gitAuth.authMethod(c.creds)
+	if err != nil {
+		return errors.Wrap(err, "failed to configure git authentication")
+	}
+
+	// Push only the change's branch, leaving the remote's other branches (e.g. a fork's
+	// default branch) untouched
+	branchSpec := plumbing.NewBranchReferenceName(c.Branch)
+	pushOptions := &git.PushOptions{
+		RemoteName: c.repo.pushRemote(),
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("%s:%s", branchSpec, branchSpec))},
+		Auth:       auth,
+	}
+
+	if force {
+		err = c.forceWithLease(ctx, pushOptions)
+		if err != nil {
+			return errors.Wrap(err, "failed to determine state of remote branch")
+		}
+	}
+
+	err = c.repo.git.PushContext(ctx, c.repo.repo, pushOptions)
 	if err != nil {
-		return errors.Wrap(err, "failed to retrieve HEAD ref of repository")
+		return errors.Wrap(err, "failed to push branch to remote repository")
+	}
+	return nil
+}
+
+// commit switches to the change's branch, created from the base, and applies each of the
+// update functions, committing after each. Commits are signed only if sign is set, so that
+// a dry run doesn't need the signing key. Returns the commit the branch was created from,
+// or ErrNoChanges if no commits are made
+func (c *Change) commit(sign bool) (plumbing.Hash, error) {
+	base, err := c.checkoutBase()
+	if err != nil {
+		return plumbing.ZeroHash, errors.Wrap(err, "failed to check out base")
 	}
 
 	branchRef := fmt.Sprintf("refs/heads/%s", c.Branch)
-	ref := plumbing.NewHashReference(plumbing.ReferenceName(branchRef), headRef.Hash())
+	ref := plumbing.NewHashReference(plumbing.ReferenceName(branchRef), base)
 	err = c.repo.repo.Storer.SetReference(ref)
 	if err != nil {
-		return errors.Wrap(err, "failed to set reference for new branch")
+		return plumbing.ZeroHash, errors.Wrap(err, "failed to set reference for new branch")
+	}
+
+	w, err := c.repo.repo.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, errors.Wrap(err, "failed to fetch Worktree for cloned repository")
+	}
+
+	// The new branch points at the base, which is checked out, so switching to it only requires
+	// updating HEAD. This avoids a checkout materialising files excluded by a sparse checkout
+	err = c.repo.repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, ref.Name()))
+	if err != nil {
+		return plumbing.ZeroHash, errors.Wrap(err, "failed to switch to new branch")
+	}
+
+	commits := 0
+	for i, updateFunc := range c.updateFuncs {
+		committed, err := c.commitUpdate(w, updateFunc, sign)
+		if err != nil {
+			return plumbing.ZeroHash, errors.Wrap(err, fmt.Sprintf("failed to apply update %d", i+1))
+		}
+		if committed {
+			commits += 1
+		}
+	}
+
+	if commits == 0 {
+		return plumbing.ZeroHash, ErrNoChanges
+	}
+
+	return base, nil
+}
+
+// checkoutBase returns the commit the change's branch is created from: the base branch as
+// cloned (or last rebuilt), or else the commit checked out when cloned. If HEAD was left
+// on the change's branch by an earlier attempt (e.g. a push which failed), the base is
+// checked out again, so that retrying applies the update functions afresh
+func (c *Change) checkoutBase() (plumbing.Hash, error) {
+	head, err := c.repo.repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return plumbing.ZeroHash, errors.Wrap(err, "failed to retrieve HEAD ref of repository")
+	}
+
+	if head.Type() != plumbing.SymbolicReference || head.Target() != plumbing.NewBranchReferenceName(c.Branch) {
+		resolved, err := c.repo.repo.Head()
+		if err != nil {
+			return plumbing.ZeroHash, errors.Wrap(err, "failed to resolve HEAD of repository")
+		}
+		return resolved.Hash(), nil
+	}
+
+	if c.repo.baseBranch != "" {
+		baseRef := plumbing.NewBranchReferenceName(c.repo.baseBranch)
+		base, err := c.repo.repo.Reference(baseRef, true)
+		if err == nil {
+			return base.Hash(), c.restoreHead(plumbing.NewSymbolicReference(plumbing.HEAD, baseRef), base.Hash())
+		}
+	}
+
+	if c.repo.baseCommit.IsZero() {
+		return plumbing.ZeroHash, errors.New("base of the change is unknown")
+	}
+	return c.repo.baseCommit, c.restoreHead(plumbing.NewHashReference(plumbing.HEAD, c.repo.baseCommit), c.repo.baseCommit)
+}
+
+// resetToLatestBase fetches the base branch and checks it out, discarding any commits
+// made by a previous push
+func (c *Change) resetToLatestBase(ctx context.Context) error {
+	base, err := c.repo.BaseBranch()
+	if err != nil {
+		return err
+	}
+
+	auth, err := c.repo.gitAuth.authMethod(c.creds)
+	if err != nil {
+		return errors.Wrap(err, "failed to configure git authentication")
+	}
+
+	baseRef := plumbing.NewBranchReferenceName(base)
+	remoteBaseRef := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, base)
+	err = c.repo.repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", baseRef, remoteBaseRef))},
+		Depth:      c.repo.depth,
+		Auth:       auth,
+		Force:      true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return errors.Wrap(err, "failed to fetch base branch")
+	}
+
+	latest, err := c.repo.repo.Reference(remoteBaseRef, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve fetched base branch")
+	}
+
+	return c.restoreHead(plumbing.NewSymbolicReference(plumbing.HEAD, baseRef), latest.Hash())
+}
+
+// restoreHead points HEAD at the supplied reference and resets the Worktree and index to
+// the supplied commit. With a sparse checkout, only the matching files are materialised
+func (c *Change) restoreHead(head *plumbing.Reference, hash plumbing.Hash) error {
+	err := c.repo.repo.Storer.SetReference(head)
+	if err != nil {
+		return errors.Wrap(err, "failed to switch HEAD")
+	}
+
+	if len(c.repo.sparsePaths) > 0 {
+		if head.Type() == plumbing.SymbolicReference {
+			err = c.repo.repo.Storer.SetReference(plumbing.NewHashReference(head.Target(), hash))
+			if err != nil {
+				return errors.Wrap(err, "failed to update branch")
+			}
+		}
+		return sparseCheckout(c.repo.repo, c.repo.sparsePaths)
 	}
 
 	w, err := c.repo.repo.Worktree()
@@ -47,11 +268,53 @@ func (c *Change) Push() error {
 		return errors.Wrap(err, "failed to fetch Worktree for cloned repository")
 	}
 
-	w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(c.Branch)})
+	return w.Reset(&git.ResetOptions{Commit: hash, Mode: git.HardReset})
+}
+
+// forceWithLease configures the push to force update only the change's branch, provided
+// the remote branch is still at the commit observed before pushing. If the branch is not
+// on the remote yet, the push is not forced, so a branch of the same name created in the
+// meantime is not overwritten
+func (c *Change) forceWithLease(ctx context.Context, pushOptions *git.PushOptions) error {
+	remote, err := c.repo.repo.Remote(pushOptions.RemoteName)
+	if err != nil {
+		return err
+	}
+
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: pushOptions.Auth})
+	if err != nil && err != transport.ErrEmptyRemoteRepository {
+		return err
+	}
+
+	branchRef := plumbing.NewBranchReferenceName(c.Branch)
+	pushOptions.RefSpecs = []config.RefSpec{config.RefSpec(fmt.Sprintf("%s:%s", branchRef, branchRef))}
+
+	for _, ref := range refs {
+		if ref.Name() == branchRef {
+			pushOptions.Force = true
+			pushOptions.RefSpecs = []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", branchRef, branchRef))}
+			pushOptions.RequireRemoteRefs = []config.RefSpec{config.RefSpec(fmt.Sprintf("%s:%s", ref.Hash(), branchRef))}
+		}
+	}
+
+	return nil
+}
+
+// commitUpdate applies an update function to the Worktree and commits the result, returning
+// false if the update function staged no changes and so no commit was made. If sign is set,
+// the commit is signed when the Change's Credentials include a CommitSigner
+func (c *Change) commitUpdate(w *git.Worktree, updateFunc UpdateFunc, sign bool) (bool, error) {
+	commitMessage, author, err := updateFunc(w)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to update Worktree with changes")
+	}
 
-	commitMessage, author, err := c.updateFunc(w)
+	changed, err := hasStagedChanges(w)
 	if err != nil {
-		return errors.Wrap(err, "failed to update Worktree with changes")
+		return false, errors.Wrap(err, "failed to fetch Worktree status")
+	}
+	if !changed {
+		return false, nil
 	}
 
 	// If no commit time is set (i.e. defaulted to the epoch), use the current time
@@ -59,24 +322,90 @@ func (c *Change) Push() error {
 		author.When = time.Now()
 	}
 
-	_, err = w.Commit(commitMessage, &git.CommitOptions{Author: author})
-	if err != nil {
-		return errors.Wrap(err, "failed to commit changes")
+	committer := author
+	if c.Committer != nil {
+		committer = &object.Signature{Name: c.Committer.Name, Email: c.Committer.Email, When: c.Committer.When}
+		if committer.When.Equal(time.Time{}) {
+			committer.When = time.Now()
+		}
 	}
 
-	branchRef = fmt.Sprintf("refs/remotes/origin/%s", c.Branch)
-	ref = plumbing.NewHashReference(plumbing.ReferenceName(branchRef), headRef.Hash())
-	err = c.repo.repo.Storer.SetReference(ref)
+	_, err = w.Commit(c.commitMessage(commitMessage, author), &git.CommitOptions{Author: author, Committer: committer})
 	if err != nil {
-		return errors.Wrap(err, "failed to set reference for remote branch")
+		return false, errors.Wrap(err, "failed to commit changes")
 	}
 
-	auth := http.BasicAuth{Username: c.creds.Username, Password: c.creds.Token}
-	err = c.repo.repo.Push(&git.PushOptions{
-		Auth: &auth,
-	})
+	if sign && c.creds.Signer != nil {
+		err = signHead(c.repo.repo, c.creds.Signer)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to sign commit")
+		}
+	}
+
+	return true, nil
+}
+
+// commitMessage appends the Change's Co-authored-by and Signed-off-by trailers to a commit message
+func (c *Change) commitMessage(message string, author *object.Signature) string {
+	trailers := []string{}
+	for _, coAuthor := range c.CoAuthors {
+		trailers = append(trailers, fmt.Sprintf("Co-authored-by: %s <%s>", coAuthor.Name, coAuthor.Email))
+	}
+	if c.SignOff {
+		trailers = append(trailers, fmt.Sprintf("Signed-off-by: %s <%s>", author.Name, author.Email))
+	}
+
+	return addTrailers(message, trailers)
+}
+
+// addTrailers appends trailers to a commit message, separated from the message body by a
+// blank line unless the message already ends with trailers. Trailers which are already
+// present in the message are not repeated
+func addTrailers(message string, trailers []string) string {
+	missing := []string{}
+	for _, trailer := range trailers {
+		if !strings.Contains(message, trailer) {
+			missing = append(missing, trailer)
+		}
+	}
+
+	if len(missing) == 0 {
+		return message
+	}
+
+	message = strings.TrimRight(message, "\n")
+	paragraphs := strings.Split(message, "\n\n")
+	separator := "\n\n"
+	if len(paragraphs) > 1 && isTrailerBlock(paragraphs[len(paragraphs)-1]) {
+		separator = "\n"
+	}
+
+	return message + separator + strings.Join(missing, "\n") + "\n"
+}
+
+// isTrailerBlock reports whether every line of a paragraph is a "Key: value" trailer
+func isTrailerBlock(paragraph string) bool {
+	for _, line := range strings.Split(paragraph, "\n") {
+		key := strings.SplitN(line, ": ", 2)[0]
+		if key == line || key == "" || strings.Contains(key, " ") {
+			return false
+		}
+	}
+	return true
+}
+
+// hasStagedChanges reports whether the Worktree has any changes staged for commit
+func hasStagedChanges(w *git.Worktree) (bool, error) {
+	status, err := w.Status()
 	if err != nil {
-		return errors.Wrap(err, "failed to push branch to remote repository")
+		return false, err
 	}
-	return nil
+
+	for _, fileStatus := range status {
+		if fileStatus.Staging != git.Unmodified && fileStatus.Staging != git.Untracked {
+			return true, nil
+		}
+	}
+
+	return false, nil
 }
@@ -1,6 +1,8 @@
 package ghpr
 
 import (
+	"context"
+	"errors"
 	"os"
 	"testing"
 
@@ -9,9 +11,11 @@ import (
 	"github.com/go-git/go-billy/v5/util"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 // Initialises a basic git repository, makes a minimal initial commit
@@ -47,9 +51,23 @@ func initGitRepo() (*git.Repository, error) {
 }
 
 func commitSomething(w *git.Worktree) (string, *object.Signature, error) {
+	_, err := w.Filesystem.Create("something")
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = w.Add("something")
+	if err != nil {
+		return "", nil, err
+	}
+
 	return "committed something!", &object.Signature{Name: "author", Email: "test@currencycloud.com"}, nil
 }
 
+func commitNothing(w *git.Worktree) (string, *object.Signature, error) {
+	return "committed nothing!", &object.Signature{Name: "author", Email: "test@currencycloud.com"}, nil
+}
+
 func temporalDir() (path string, clean func()) {
 	fs := osfs.New(os.TempDir())
 	path, err := util.TempDir(fs, "", "")
@@ -84,7 +102,7 @@ func TestPushCommit(t *testing.T) {
 
 	fs := memfs.New()
 
-	r := newRepo("shteou", "go-ghpr", fs, new(mockGoGit))
+	r := newRepo("shteou", "go-ghpr", fs, newMockGoGit())
 	r.repo = repo
 
 	_, err = r.repo.CreateRemote(&config.RemoteConfig{
@@ -114,3 +132,302 @@ func TestPushCommit(t *testing.T) {
 	// to the empty remote repo
 	assert.Equal(t, 2, count, "The remote repository had the wrong number of commits")
 }
+
+func TestPushCancelled(t *testing.T) {
+	mockGit := new(mockGoGit)
+	mockGit.On("PushContext",
+		mock.MatchedBy(func(ctx context.Context) bool { return ctx.Err() != nil }),
+		mock.Anything,
+		mock.Anything,
+	).Return(context.Canceled)
+
+	// Given a cloned repository
+	originPath, originRepo := mockRemoteRepository(t)
+	r := clonedRepo(t, originPath)
+	r.git = mockGit
+
+	// When I push a change with a cancelled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	change := NewChange(r, "foo", Credentials{}, commitSomething)
+	err := change.PushContext(ctx)
+
+	// Then the cancellation is returned
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+	mockGit.AssertExpectations(t)
+
+	// And nothing has been pushed
+	_, err = originRepo.Reference(plumbing.NewBranchReferenceName("foo"), true)
+	assert.Equal(t, plumbing.ErrReferenceNotFound, err)
+}
+
+func TestPushRetryAfterFailure(t *testing.T) {
+	mockGit := new(mockGoGit)
+	mockGit.On("PushContext", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("connection reset")).Once()
+	mockGit.On("PushContext", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	// Given a change whose first push fails
+	originPath, originRepo := mockRemoteRepository(t)
+	r := clonedRepo(t, originPath)
+	r.git = mockGit
+	change := NewMultiCommitChange(r, "foo", Credentials{}, commitSomething, commitSomethingElse)
+	assert.NotNil(t, change.Push())
+
+	// When I retry the push
+	err := change.Push()
+
+	// Then the updates are applied again on top of the base and pushed
+	assert.Nil(t, err)
+	ref, err := originRepo.Reference("refs/heads/foo", true)
+	assert.Nil(t, err)
+	commit, err := originRepo.CommitObject(ref.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, "committed something else!", commit.Message)
+
+	parent, err := commit.Parent(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "committed something!", parent.Message)
+	assert.Equal(t, r.baseCommit, parent.ParentHashes[0])
+}
+
+func TestPushNoChanges(t *testing.T) {
+	// Given a remote repository
+	originPath, originRepo := mockRemoteRepository(t)
+
+	// And a cloned repository referencing that remote
+	repo, err := initGitRepo()
+	assert.Nil(t, err)
+
+	r := newRepo("shteou", "go-ghpr", memfs.New(), newMockGoGit())
+	r.repo = repo
+
+	_, err = r.repo.CreateRemote(&config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{originPath},
+	})
+	assert.Nil(t, err)
+
+	// When I push an update which changes nothing
+	change := NewChange(r, "foo", Credentials{}, commitNothing)
+	err = change.Push()
+
+	// Then a no changes error is returned
+	assert.Equal(t, ErrNoChanges, err)
+
+	// And nothing has been pushed to the remote repository
+	commitIter, err := originRepo.CommitObjects()
+	assert.Nil(t, err)
+
+	count := 0
+	commitIter.ForEach(func(c *object.Commit) error {
+		count += 1
+		return nil
+	})
+	assert.Equal(t, 0, count, "The remote repository should have no commits")
+}
+
+func commitSomethingElse(w *git.Worktree) (string, *object.Signature, error) {
+	_, err := w.Filesystem.Create("something-else")
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = w.Add("something-else")
+	if err != nil {
+		return "", nil, err
+	}
+
+	return "committed something else!", &object.Signature{Name: "author", Email: "test@currencycloud.com"}, nil
+}
+
+func TestPushMultipleCommits(t *testing.T) {
+	// Given a remote repository
+	originPath, originRepo := mockRemoteRepository(t)
+
+	// And a cloned repository referencing that remote
+	repo, err := initGitRepo()
+	assert.Nil(t, err)
+
+	r := newRepo("shteou", "go-ghpr", memfs.New(), newMockGoGit())
+	r.repo = repo
+
+	_, err = r.repo.CreateRemote(&config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{originPath},
+	})
+	assert.Nil(t, err)
+
+	// When I push a change made up of several updates, one of which changes nothing
+	change := NewMultiCommitChange(r, "foo", Credentials{}, commitSomething, commitNothing, commitSomethingElse)
+	err = change.Push()
+
+	// Then there are no errors
+	assert.Nil(t, err)
+
+	// And a commit for each update which made changes has been pushed
+	commitIter, err := originRepo.CommitObjects()
+	assert.Nil(t, err)
+
+	count := 0
+	commitIter.ForEach(func(c *object.Commit) error {
+		count += 1
+		return nil
+	})
+	assert.Equal(t, 3, count, "The remote repository had the wrong number of commits")
+}
+
+// clonedRepo emulates a fresh clone of the supplied remote
+func clonedRepo(t *testing.T, originPath string) Repo {
+	repo, err := initGitRepo()
+	assert.Nil(t, err)
+
+	r := newRepo("shteou", "go-ghpr", memfs.New(), newMockGoGit())
+	r.repo = repo
+	assert.Nil(t, r.recordBaseBranch())
+
+	_, err = r.repo.CreateRemote(&config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{originPath},
+	})
+	assert.Nil(t, err)
+
+	return r
+}
+
+func TestPushForceUpdatesExistingBranch(t *testing.T) {
+	// Given a remote repository with a branch pushed by a previous run
+	originPath, originRepo := mockRemoteRepository(t)
+	previous := NewChange(clonedRepo(t, originPath), "foo", Credentials{}, commitSomething)
+	assert.Nil(t, previous.Push())
+
+	// When I push a different change to the same branch
+	change := NewChange(clonedRepo(t, originPath), "foo", Credentials{}, commitSomethingElse)
+	err := change.Push()
+
+	// Then the push is rejected
+	assert.NotNil(t, err)
+
+	// But when I force update the branch from a fresh clone
+	change = NewChange(clonedRepo(t, originPath), "foo", Credentials{}, commitSomethingElse)
+	change.ForceUpdate = true
+	err = change.Push()
+
+	// Then there are no errors
+	assert.Nil(t, err)
+
+	// And the remote branch has been replaced
+	ref, err := originRepo.Reference("refs/heads/foo", true)
+	assert.Nil(t, err)
+	commit, err := originRepo.CommitObject(ref.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, "committed something else!", commit.Message)
+}
+
+func TestForceUpdateDoesNotOverwriteNewBranch(t *testing.T) {
+	// Given a force update of a branch which is not yet on the remote
+	originPath, originRepo := mockRemoteRepository(t)
+	change := NewChange(clonedRepo(t, originPath), "foo", Credentials{}, commitSomethingElse)
+	_, err := change.commit(true)
+	assert.Nil(t, err)
+
+	pushOptions := &git.PushOptions{RemoteName: "origin"}
+	assert.Nil(t, change.forceWithLease(context.Background(), pushOptions))
+	assert.False(t, pushOptions.Force)
+
+	// When the branch is created by someone else before the push completes
+	other := NewChange(clonedRepo(t, originPath), "foo", Credentials{}, commitSomething)
+	assert.Nil(t, other.Push())
+	err = change.repo.git.PushContext(context.Background(), change.repo.repo, pushOptions)
+
+	// Then the push is rejected
+	assert.NotNil(t, err)
+
+	// And their branch is left in place
+	ref, err := originRepo.Reference("refs/heads/foo", true)
+	assert.Nil(t, err)
+	commit, err := originRepo.CommitObject(ref.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, "committed something!", commit.Message)
+}
+
+func TestAddTrailers(t *testing.T) {
+	trailers := []string{"Signed-off-by: bot <bot@example.com>"}
+
+	assert.Equal(t, "chore: update\n\nSigned-off-by: bot <bot@example.com>\n",
+		addTrailers("chore: update\n", trailers))
+	assert.Equal(t, "chore: update\n\nRefs: #1\nSigned-off-by: bot <bot@example.com>\n",
+		addTrailers("chore: update\n\nRefs: #1", trailers))
+	assert.Equal(t, "chore: update\n\nSigned-off-by: bot <bot@example.com>",
+		addTrailers("chore: update\n\nSigned-off-by: bot <bot@example.com>", trailers))
+	assert.Equal(t, "chore: update", addTrailers("chore: update", nil))
+}
+
+func TestPushCommitterAndTrailers(t *testing.T) {
+	// Given a remote repository
+	originPath, originRepo := mockRemoteRepository(t)
+
+	// When I push a change committed by a bot, co-authored and signed off
+	change := NewChange(clonedRepo(t, originPath), "foo", Credentials{}, commitSomething)
+	change.Committer = &object.Signature{Name: "bot", Email: "bot@example.com"}
+	change.CoAuthors = []object.Signature{{Name: "reviewer", Email: "reviewer@example.com"}}
+	change.SignOff = true
+	err := change.Push()
+	assert.Nil(t, err)
+
+	// Then the author and committer are recorded separately
+	ref, err := originRepo.Reference("refs/heads/foo", true)
+	assert.Nil(t, err)
+	commit, err := originRepo.CommitObject(ref.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, "author", commit.Author.Name)
+	assert.Equal(t, "bot", commit.Committer.Name)
+
+	// And the trailers are appended to the message, signed off by the author
+	assert.Equal(t, "committed something!\n\n"+
+		"Co-authored-by: reviewer <reviewer@example.com>\n"+
+		"Signed-off-by: author <test@currencycloud.com>\n", commit.Message)
+}
+
+func TestRebuildOnMovedBase(t *testing.T) {
+	// Given a change pushed from a clone of the remote repository
+	originPath := mockMonorepo(t)
+	repo, err := git.Clone(memory.NewStorage(), memfs.New(), &git.CloneOptions{URL: originPath})
+	assert.Nil(t, err)
+	r := newRepo("shteou", "go-ghpr", memfs.New(), newMockGoGit())
+	r.repo = repo
+	assert.Nil(t, r.recordBaseBranch())
+
+	change := NewChange(r, "foo", Credentials{}, commitSomething)
+	assert.Nil(t, change.Push())
+
+	// And the base branch has since moved on
+	origin, err := git.PlainOpen(originPath)
+	assert.Nil(t, err)
+	w, err := origin.Worktree()
+	assert.Nil(t, err)
+	_, _, err = updateDeployment(w)
+	assert.Nil(t, err)
+	baseHash, err := w.Commit("move base", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test.test"}})
+	assert.Nil(t, err)
+
+	// When I rebuild the change
+	err = change.Rebuild()
+
+	// Then there are no errors
+	assert.Nil(t, err)
+
+	// And the remote branch is a single commit on top of the latest base
+	ref, err := origin.Reference("refs/heads/foo", true)
+	assert.Nil(t, err)
+	commit, err := origin.CommitObject(ref.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, "committed something!", commit.Message)
+	assert.Equal(t, []plumbing.Hash{baseHash}, commit.ParentHashes)
+}
+
+func TestRebuildRequiresClone(t *testing.T) {
+	change := NewChange(newRepo("shteou", "go-ghpr", memfs.New(), newMockGoGit()), "foo", Credentials{}, commitSomething)
+
+	assert.NotNil(t, change.Rebuild())
+}
@@ -0,0 +1,220 @@
+package ghpr
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+	"github.com/pkg/errors"
+)
+
+// FileAction describes how a file is affected by a Change
+type FileAction string
+
+const (
+	FileAdded    FileAction = "added"
+	FileDeleted  FileAction = "deleted"
+	FileModified FileAction = "modified"
+	FileRenamed  FileAction = "renamed"
+)
+
+// FileDiff describes the change to a single file
+type FileDiff struct {
+	Action FileAction
+	// From is the path of the file before the change, empty if the file was added
+	From string
+	// To is the path of the file after the change, empty if the file was deleted
+	To string
+	// Patch is the unified diff of the file
+	Patch string
+}
+
+// Diff describes the changes a Change would make to its repository
+type Diff struct {
+	Files []FileDiff
+	// Patch is the unified diff of all files, as printed by git diff
+	Patch string
+}
+
+// String returns the unified diff of all files
+func (d *Diff) String() string {
+	return d.Patch
+}
+
+// DryRun applies your update functions as Push would, but returns the resulting changes
+// rather than pushing them. The remote repository is never contacted, and the local
+// repository is restored to its previous state afterwards, so the Change can still be
+// pushed. Commits are not signed, so no signing key is needed. As with Push, ErrNoChanges is
+// returned if the update functions stage no changes. As restoring the repository discards
+// uncommitted changes, an error is returned if the worktree has any, e.g. in a workspace
+// opened with OpenRepo. Untracked files are left alone
+func (c *Change) DryRun() (*Diff, error) {
+	if c.repo.repo == nil {
+		return nil, errors.New("repository must be cloned before the change is dry run")
+	}
+
+	err := c.requireCleanWorktree()
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := c.repo.repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve HEAD ref of repository")
+	}
+
+	branchRef := plumbing.NewBranchReferenceName(c.Branch)
+	existingBranch, err := c.repo.repo.Storer.Reference(branchRef)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return nil, errors.Wrap(err, "failed to retrieve existing branch")
+	}
+
+	var diff *Diff
+	base, err := c.commit(false)
+	if err == nil {
+		diff, err = c.diff(base)
+	}
+
+	// Restore the repository even if the update functions failed
+	restoreErr := c.restoreBranch(head, branchRef, existingBranch)
+	if err != nil {
+		return nil, err
+	}
+	if restoreErr != nil {
+		return nil, errors.Wrap(restoreErr, "failed to restore repository after dry run")
+	}
+
+	return diff, nil
+}
+
+// diff computes the changes between the base commit and HEAD, once the update functions
+// have been committed
+func (c *Change) diff(base plumbing.Hash) (*Diff, error) {
+	baseCommit, err := c.repo.repo.CommitObject(base)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve base commit")
+	}
+
+	headRef, err := c.repo.repo.Head()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve HEAD ref of repository")
+	}
+
+	headCommit, err := c.repo.repo.CommitObject(headRef.Hash())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve HEAD commit")
+	}
+
+	baseTree, err := baseCommit.Tree()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve base tree")
+	}
+
+	headTree, err := headCommit.Tree()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve HEAD tree")
+	}
+
+	changes, err := object.DiffTreeWithOptions(context.Background(), baseTree, headTree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compare trees")
+	}
+
+	diff := &Diff{}
+	for _, change := range changes {
+		fileDiff, err := newFileDiff(change)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to compute diff of "+change.String())
+		}
+		diff.Files = append(diff.Files, fileDiff)
+	}
+
+	patch, err := changes.Patch()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compute patch")
+	}
+	diff.Patch = patch.String()
+
+	return diff, nil
+}
+
+// newFileDiff describes a single changed file between two trees
+func newFileDiff(change *object.Change) (FileDiff, error) {
+	action, err := change.Action()
+	if err != nil {
+		return FileDiff{}, err
+	}
+
+	patch, err := change.Patch()
+	if err != nil {
+		return FileDiff{}, err
+	}
+
+	fileDiff := FileDiff{From: change.From.Name, To: change.To.Name, Patch: patch.String()}
+	switch {
+	case action == merkletrie.Insert:
+		fileDiff.Action = FileAdded
+	case action == merkletrie.Delete:
+		fileDiff.Action = FileDeleted
+	case fileDiff.From != fileDiff.To:
+		fileDiff.Action = FileRenamed
+	default:
+		fileDiff.Action = FileModified
+	}
+
+	return fileDiff, nil
+}
+
+// requireCleanWorktree returns an error if tracked files have uncommitted changes. With a
+// sparse checkout, only files within the checked out paths are considered
+func (c *Change) requireCleanWorktree() error {
+	w, err := c.repo.repo.Worktree()
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch Worktree for repository")
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve status of worktree")
+	}
+
+	for path, file := range status {
+		if file.Worktree == git.Untracked {
+			continue
+		}
+		if len(c.repo.sparsePaths) > 0 && !sparseMatch(c.repo.sparsePaths, path) {
+			continue
+		}
+		if file.Worktree != git.Unmodified || file.Staging != git.Unmodified {
+			return fmt.Errorf("worktree has uncommitted changes to %s, which a dry run would discard", path)
+		}
+	}
+
+	return nil
+}
+
+// restoreBranch undoes the commits made by a dry run, pointing HEAD and the change's branch
+// back at where they were and resetting the Worktree to match
+func (c *Change) restoreBranch(head *plumbing.Reference, branchRef plumbing.ReferenceName, existingBranch *plumbing.Reference) error {
+	base := head.Hash()
+	if head.Type() == plumbing.SymbolicReference {
+		ref, err := c.repo.repo.Storer.Reference(head.Target())
+		if err != nil {
+			return err
+		}
+		base = ref.Hash()
+	}
+
+	err := c.restoreHead(head, base)
+	if err != nil {
+		return err
+	}
+
+	if existingBranch != nil {
+		return c.repo.repo.Storer.SetReference(existingBranch)
+	}
+	return c.repo.repo.Storer.RemoveReference(branchRef)
+}
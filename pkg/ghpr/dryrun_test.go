@@ -0,0 +1,151 @@
+package ghpr
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func updateTestFile(w *git.Worktree) (string, *object.Signature, error) {
+	err := util.WriteFile(w.Filesystem, "test", []byte("updated\n"), 0644)
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = w.Add("test")
+	if err != nil {
+		return "", nil, err
+	}
+
+	return "updated test!", &object.Signature{Name: "author", Email: "test@currencycloud.com"}, nil
+}
+
+func TestDryRun(t *testing.T) {
+	// Given a cloned repository
+	originPath, originRepo := mockRemoteRepository(t)
+	r := clonedRepo(t, originPath)
+
+	// When I dry run a change which adds one file and modifies another
+	change := NewMultiCommitChange(r, "foo", Credentials{}, commitSomething, updateTestFile)
+	diff, err := change.DryRun()
+
+	// Then the diff describes each file
+	assert.Nil(t, err)
+	assert.Equal(t, []FileAction{FileAdded, FileModified}, []FileAction{diff.Files[0].Action, diff.Files[1].Action})
+	assert.Equal(t, "something", diff.Files[0].To)
+	assert.Equal(t, "", diff.Files[0].From)
+	assert.Contains(t, diff.Files[1].Patch, "+updated")
+
+	// And the patch covers every file
+	assert.Contains(t, diff.String(), "diff --git a/test b/test")
+	assert.Contains(t, diff.String(), "b/something")
+
+	// And nothing has been pushed
+	_, err = originRepo.Reference(plumbing.NewBranchReferenceName("foo"), true)
+	assert.Equal(t, plumbing.ErrReferenceNotFound, err)
+
+	// And the local repository is unchanged, so the change can still be pushed
+	_, err = r.repo.Reference(plumbing.NewBranchReferenceName("foo"), true)
+	assert.Equal(t, plumbing.ErrReferenceNotFound, err)
+
+	head, err := r.repo.Head()
+	assert.Nil(t, err)
+	assert.Equal(t, plumbing.NewBranchReferenceName("master"), head.Name())
+
+	assert.Nil(t, change.Push())
+	pushed, err := originRepo.Reference(plumbing.NewBranchReferenceName("foo"), true)
+	assert.Nil(t, err)
+	commit, err := originRepo.CommitObject(pushed.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, "updated test!", commit.Message)
+}
+
+type unusableSigner struct{}
+
+func (unusableSigner) sign(message io.Reader) (string, error) {
+	return "", errors.New("signing key is unavailable")
+}
+
+func TestDryRunDoesNotSign(t *testing.T) {
+	// Given a cloned repository and credentials whose signing key is unavailable
+	originPath, _ := mockRemoteRepository(t)
+	r := clonedRepo(t, originPath)
+
+	// When I dry run a change
+	change := NewChange(r, "foo", Credentials{Signer: unusableSigner{}}, commitSomething)
+	diff, err := change.DryRun()
+
+	// Then the diff is produced without signing
+	assert.Nil(t, err)
+	assert.Len(t, diff.Files, 1)
+}
+
+func renameTestFile(w *git.Worktree) (string, *object.Signature, error) {
+	_, err := w.Move("test", "renamed")
+	if err != nil {
+		return "", nil, err
+	}
+
+	return "renamed test!", &object.Signature{Name: "author", Email: "test@currencycloud.com"}, nil
+}
+
+func TestDryRunRename(t *testing.T) {
+	// Given a cloned repository
+	originPath, _ := mockRemoteRepository(t)
+	r := clonedRepo(t, originPath)
+
+	// When I dry run a change which renames a file
+	change := NewChange(r, "foo", Credentials{}, renameTestFile)
+	diff, err := change.DryRun()
+
+	// Then the diff describes the rename
+	assert.Nil(t, err)
+	assert.Len(t, diff.Files, 1)
+	assert.Equal(t, FileDiff{Action: FileRenamed, From: "test", To: "renamed", Patch: diff.Files[0].Patch}, diff.Files[0])
+	assert.Contains(t, diff.String(), "rename from test")
+}
+
+func TestDryRunNoChanges(t *testing.T) {
+	// Given a cloned repository
+	originPath, _ := mockRemoteRepository(t)
+	r := clonedRepo(t, originPath)
+
+	// When I dry run a change which changes nothing
+	change := NewChange(r, "foo", Credentials{}, commitNothing)
+	_, err := change.DryRun()
+
+	// Then ErrNoChanges is returned
+	assert.Equal(t, ErrNoChanges, err)
+
+	// And the repository is back on its original branch
+	head, err := r.repo.Head()
+	assert.Nil(t, err)
+	assert.Equal(t, plumbing.NewBranchReferenceName("master"), head.Name())
+}
+
+func TestDryRunDirtyWorktree(t *testing.T) {
+	// Given a cloned repository with uncommitted changes
+	originPath, _ := mockRemoteRepository(t)
+	r := clonedRepo(t, originPath)
+	w, err := r.repo.Worktree()
+	assert.Nil(t, err)
+	assert.Nil(t, util.WriteFile(w.Filesystem, "test", []byte("work in progress\n"), 0644))
+
+	// When I dry run a change
+	change := NewChange(r, "foo", Credentials{}, commitSomething)
+	_, err = change.DryRun()
+
+	// Then the dry run is refused
+	assert.EqualError(t, err, "worktree has uncommitted changes to test, which a dry run would discard")
+
+	// And the uncommitted changes are kept
+	content, err := util.ReadFile(w.Filesystem, "test")
+	assert.Nil(t, err)
+	assert.Equal(t, "work in progress\n", string(content))
+}
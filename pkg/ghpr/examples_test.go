@@ -64,7 +64,7 @@ func ExamplePR_Create() {
 	fmt.Printf("New pull request raised at %s\n", url)
 }
 
-func ExamplePR_WaitForPRStatus() {
+func ExamplePR_WaitForPRChecks() {
 	pr, _ := basicPR()
 	_ = pr.Create(context.Background(), "main", "chore: remove obsolete files", "")
 
@@ -78,7 +78,7 @@ func ExamplePR_WaitForPRStatus() {
 	_ = pr.WaitForPRChecks(context.Background(), statusChecks, strategy)
 }
 
-func ExamplePR_WaitForMergeable() {
+func ExamplePR_WaitForPRMergeable() {
 	pr, _ := basicPR()
 	_ = pr.Create(context.Background(), "main", "chore: remove obsolete files", "")
 	strategy := ghpr.BackoffStrategy{MinPollTime: 10 * time.Second, MaxPollTime: 60 * time.Second, PollBackoffFactor: 1.05}
@@ -91,7 +91,7 @@ func ExamplePR_Merge() {
 	_ = pr.Merge(context.Background(), "squash")
 }
 
-func ExamplePR_WaitForMergeStatus() {
+func ExamplePR_WaitForMergeChecks() {
 	pr, _ := basicPR()
 	_ = pr.Create(context.Background(), "main", "chore: remove obsolete files", "")
 
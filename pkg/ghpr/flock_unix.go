@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package ghpr
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockFile takes an exclusive lock on an open file, blocking until it is available. The lock
+// is released when the file is unlocked or closed, including when the process exits
+func lockFile(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_EX)
+}
+
+func unlockFile(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_UN)
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package ghpr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestLockMirrorAcrossProcesses(t *testing.T) {
+	dir, clean := temporalDir()
+	defer clean()
+	mirror := filepath.Join(dir, "go-ghpr.git")
+
+	// Given a locked mirror
+	unlock, err := lockMirror(mirror)
+	assert.Nil(t, err)
+
+	// When another process tries to lock it, as emulated by a separate open file
+	f, err := os.Open(mirror + ".lock")
+	assert.Nil(t, err)
+	defer f.Close()
+
+	// Then the mirror is held until it is unlocked
+	assert.Equal(t, unix.EWOULDBLOCK, unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB))
+	unlock()
+	assert.Nil(t, unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB))
+}
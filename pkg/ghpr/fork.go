@@ -0,0 +1,116 @@
+package ghpr
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/google/go-github/github"
+	"github.com/jpillora/backoff"
+	"github.com/pkg/errors"
+)
+
+// forkRemoteName is the name of the git remote for the fork changes are pushed to
+const forkRemoteName = "fork"
+
+// Fork forks the remote repository into the supplied organization, or the authenticated
+// user's account if empty, reusing an existing fork if there is one. Changes created from
+// the Repo afterwards are pushed to the fork, and PRs are raised from the fork to the
+// remote repository. The repository must have been cloned before it is forked
+func (r *Repo) Fork(ctx context.Context, creds Credentials, organization string) error {
+	return r.fork(ctx, newGitHubClient(ctx, r.host, creds), organization)
+}
+
+func (r *Repo) fork(ctx context.Context, client *github.Client, organization string) error {
+	if r.repo == nil {
+		return errors.New("repository must be cloned before it is forked")
+	}
+
+	fork, _, err := client.Repositories.CreateFork(ctx, r.Owner, r.Name,
+		&github.RepositoryCreateForkOptions{Organization: organization})
+	if _, ok := err.(*github.AcceptedError); !ok && err != nil {
+		return errors.Wrap(err, "failed to fork repository")
+	}
+
+	forkOwner, forkName := fork.GetOwner().GetLogin(), fork.GetName()
+	if forkOwner == "" {
+		forkOwner, err = forkDestination(ctx, client, organization)
+		if err != nil {
+			return err
+		}
+		forkName = r.Name
+	}
+
+	err = waitForFork(ctx, client, forkOwner, forkName)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.repo.CreateRemote(&config.RemoteConfig{
+		Name: forkRemoteName,
+		URLs: []string{r.gitAuth.remoteURL(r.host, forkOwner, forkName)},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to add remote for fork")
+	}
+
+	r.forkOwner = forkOwner
+	return nil
+}
+
+// pushRemote returns the name of the git remote which changes are pushed to
+func (r *Repo) pushRemote() string {
+	if r.forkOwner != "" {
+		return forkRemoteName
+	}
+	return git.DefaultRemoteName
+}
+
+// headOwner returns the owner of the repository which changes are pushed to
+func (r *Repo) headOwner() string {
+	if r.forkOwner != "" {
+		return r.forkOwner
+	}
+	return r.Owner
+}
+
+// forkDestination returns the account a fork is created in
+func forkDestination(ctx context.Context, client *github.Client, organization string) (string, error) {
+	if organization != "" {
+		return organization, nil
+	}
+
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to retrieve authenticated user")
+	}
+
+	return user.GetLogin(), nil
+}
+
+// waitForFork polls until GitHub has finished creating a fork, which happens asynchronously
+func waitForFork(ctx context.Context, client *github.Client, owner string, name string) error {
+	b := &backoff.Backoff{
+		Min:    time.Second,
+		Max:    10 * time.Second,
+		Factor: 2,
+		Jitter: true,
+	}
+
+	for {
+		_, resp, err := client.Repositories.Get(ctx, owner, name)
+		if err == nil {
+			return nil
+		}
+		if resp == nil || resp.StatusCode != 404 {
+			return errors.Wrap(err, "failed to retrieve fork")
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.New("timed out waiting for fork to be created")
+		case <-time.After(b.Duration()):
+		}
+	}
+}
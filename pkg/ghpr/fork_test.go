@@ -0,0 +1,95 @@
+package ghpr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoFork(t *testing.T) {
+	// Given GitHub creates a fork asynchronously in the authenticated user's account
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/shteou/go-ghpr/forks", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login": "bot"}`)
+	})
+	mux.HandleFunc("/repos/bot/go-ghpr", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name": "go-ghpr", "owner": {"login": "bot"}}`)
+	})
+
+	repo, err := initGitRepo()
+	assert.Nil(t, err)
+	r := newRepo("shteou", "go-ghpr", memfs.New(), new(mockGoGit))
+	r.repo = repo
+
+	// When I fork the repository
+	err = r.fork(context.Background(), testGitHubClient(t, mux), "")
+
+	// Then changes are pushed to the fork
+	assert.Nil(t, err)
+	assert.Equal(t, "fork", r.pushRemote())
+	remote, err := r.repo.Remote("fork")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://github.com/bot/go-ghpr"}, remote.Config().URLs)
+
+	// And PRs are raised from the fork
+	pr := newPR(NewChange(r, "foo", Credentials{}, dummyFunc), nil)
+	assert.Equal(t, "bot:foo", pr.head())
+}
+
+func TestPushToForkLeavesOtherBranches(t *testing.T) {
+	// Given a fork whose default branch has diverged from the remote repository
+	originPath, _ := mockRemoteRepository(t)
+	forkPath, forkRepo := mockRemoteRepository(t)
+
+	diverged, err := initGitRepo()
+	assert.Nil(t, err)
+	w, err := diverged.Worktree()
+	assert.Nil(t, err)
+	message, author, err := commitSomethingElse(w)
+	assert.Nil(t, err)
+	_, err = w.Commit(message, &git.CommitOptions{Author: author})
+	assert.Nil(t, err)
+	_, err = diverged.CreateRemote(&config.RemoteConfig{Name: "fork", URLs: []string{forkPath}})
+	assert.Nil(t, err)
+	assert.Nil(t, diverged.Push(&git.PushOptions{RemoteName: "fork"}))
+	forkMaster, err := forkRepo.Reference("refs/heads/master", true)
+	assert.Nil(t, err)
+
+	// And a clone of the remote repository which pushes to the fork
+	r := clonedRepo(t, originPath)
+	_, err = r.repo.CreateRemote(&config.RemoteConfig{Name: forkRemoteName, URLs: []string{forkPath}})
+	assert.Nil(t, err)
+	r.forkOwner = "bot"
+
+	// When I push a change
+	change := NewChange(r, "foo", Credentials{}, commitSomething)
+	err = change.Push()
+
+	// Then only the change's branch is pushed to the fork
+	assert.Nil(t, err)
+	_, err = forkRepo.Reference("refs/heads/foo", true)
+	assert.Nil(t, err)
+
+	// And the fork's default branch is left untouched
+	ref, err := forkRepo.Reference("refs/heads/master", true)
+	assert.Nil(t, err)
+	assert.Equal(t, forkMaster.Hash(), ref.Hash())
+}
+
+func TestRepoForkRequiresClone(t *testing.T) {
+	r := newRepo("shteou", "go-ghpr", memfs.New(), new(mockGoGit))
+
+	err := r.fork(context.Background(), nil, "")
+
+	assert.NotNil(t, err)
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/oauth2"
 )
 
 // UpdateFunc is a callback function which should create a series of changes
@@ -12,10 +13,23 @@ import (
 // return by the PushCommit function
 type UpdateFunc func(w *git.Worktree) (string, *object.Signature, error)
 
-// Credentials represents a GitHub username and PAT
+// Credentials represents a GitHub username and PAT, or a source of
+// short-lived tokens such as GitHub App installation tokens
 type Credentials struct {
 	Username string
 	Token    string
+	// TokenSource, if set, is used in place of Token. See NewAppCredentials
+	TokenSource oauth2.TokenSource
+	// Signer, if set, signs commits made by Change.Push. See NewGPGSigner and NewSSHSigner
+	Signer CommitSigner
+}
+
+// tokenSource returns a source of tokens for authenticating with GitHub
+func (c Credentials) tokenSource() oauth2.TokenSource {
+	if c.TokenSource != nil {
+		return c.TokenSource
+	}
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: c.Token})
 }
 
 // Author represents information about the creator of a commit
@@ -38,6 +52,9 @@ type BackoffStrategy struct {
 type Check struct {
 	// Name of the check, e.g. "Semantic Pull Request"
 	Name string
-	// CheckType the type of check, either "action" or "status"
+	// CheckType the type of check, either "action" (a check run, e.g. a GitHub Actions job)
+	// or "status" (a commit status). Check suites are not supported, as GitHub creates a
+	// suite for every installed app which may never run, leaving it queued indefinitely.
+	// Wait for the suite's individual check runs as actions instead
 	CheckType string
 }
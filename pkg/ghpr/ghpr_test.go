@@ -1,6 +1,8 @@
 package ghpr
 
 import (
+	"context"
+
 	"github.com/go-git/go-billy/v5"
 
 	"github.com/go-git/go-git/v5"
@@ -16,8 +18,8 @@ type mockGoGit struct {
 	mock.Mock
 }
 
-func (g *mockGoGit) Clone(s storage.Storer, worktree billy.Filesystem, o *git.CloneOptions) (*git.Repository, error) {
-	args := g.Called(s, worktree, o)
+func (g *mockGoGit) CloneContext(ctx context.Context, s storage.Storer, worktree billy.Filesystem, o *git.CloneOptions) (*git.Repository, error) {
+	args := g.Called(ctx, s, worktree, o)
 
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -26,6 +28,21 @@ func (g *mockGoGit) Clone(s storage.Storer, worktree billy.Filesystem, o *git.Cl
 	return args.Get(0).(*git.Repository), args.Error(1)
 }
 
-func (g *mockGoGit) Push(o *git.PushOptions) error {
-	return nil
+// PushContext returns the error stubbed for the push, if any, or otherwise forwards the
+// push to go-git
+func (g *mockGoGit) PushContext(ctx context.Context, r *git.Repository, o *git.PushOptions) error {
+	args := g.Called(ctx, r, o)
+	if err := args.Error(0); err != nil {
+		return err
+	}
+
+	return r.PushContext(ctx, o)
+}
+
+// newMockGoGit returns a mockGoGit whose pushes are forwarded to go-git, e.g. to push
+// to a local remote repository
+func newMockGoGit() *mockGoGit {
+	g := new(mockGoGit)
+	g.On("PushContext", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	return g
 }
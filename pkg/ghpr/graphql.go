@@ -0,0 +1,59 @@
+package ghpr
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// graphQL sends a query or mutation to the GraphQL API of the host the client targets,
+// decoding the response's data into result, if not nil. GitHub reports GraphQL errors
+// with a successful status, so these are returned as an error
+func graphQL(ctx context.Context, client *github.Client, query string, variables map[string]interface{}, result interface{}) error {
+	// The GraphQL API is at /graphql on github.com, and /api/graphql on GitHub Enterprise
+	// Server, whose REST API is at /api/v3/
+	endpoint := "graphql"
+	if strings.HasSuffix(client.BaseURL.Path, "/api/v3/") {
+		endpoint = "../graphql"
+	}
+
+	req, err := client.NewRequest("POST", endpoint, &graphQLRequest{Query: query, Variables: variables})
+	if err != nil {
+		return err
+	}
+
+	response := &graphQLResponse{}
+	_, err = client.Do(ctx, req, response)
+	if err != nil {
+		return err
+	}
+
+	if len(response.Errors) > 0 {
+		messages := []string{}
+		for _, e := range response.Errors {
+			messages = append(messages, e.Message)
+		}
+		return errors.New(strings.Join(messages, "; "))
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(response.Data, result)
+}
@@ -0,0 +1,50 @@
+package ghpr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphQLEnterpriseEndpoint(t *testing.T) {
+	// Given a GitHub Enterprise Server API
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/graphql", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": {"viewer": {"login": "bot"}}}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/api/v3/")
+
+	// When I send a GraphQL query
+	result := struct {
+		Viewer struct{ Login string }
+	}{}
+	err := graphQL(context.Background(), client, `{ viewer { login } }`, nil, &result)
+
+	// Then it is sent to the GraphQL endpoint alongside the REST API
+	assert.Nil(t, err)
+	assert.Equal(t, "bot", result.Viewer.Login)
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	// Given GitHub reports errors in a successful response
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": null, "errors": [{"message": "Could not resolve to a node"}]}`)
+	})
+
+	// When I send a GraphQL query
+	err := graphQL(context.Background(), testGitHubClient(t, mux), `{ viewer { login } }`, nil, nil)
+
+	// Then the errors are returned
+	assert.EqualError(t, err, "Could not resolve to a node")
+}
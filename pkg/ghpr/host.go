@@ -0,0 +1,105 @@
+package ghpr
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultWebURL = "https://github.com/"
+)
+
+// Host describes the GitHub instance which hosts a repository. The zero value
+// represents github.com, enterprise instances may be described with NewHost
+// or NewEnterpriseHost
+type Host struct {
+	webURL    *url.URL
+	apiURL    *url.URL
+	uploadURL *url.URL
+}
+
+// NewHost creates a Host from explicit web, API and upload base URLs, e.g.
+// https://github.example.com/, https://github.example.com/api/v3/ and
+// https://github.example.com/api/uploads/
+func NewHost(webURL string, apiURL string, uploadURL string) (Host, error) {
+	web, err := parseBaseURL(webURL)
+	if err != nil {
+		return Host{}, errors.Wrap(err, "failed to parse web URL")
+	}
+
+	api, err := parseBaseURL(apiURL)
+	if err != nil {
+		return Host{}, errors.Wrap(err, "failed to parse API URL")
+	}
+
+	upload, err := parseBaseURL(uploadURL)
+	if err != nil {
+		return Host{}, errors.Wrap(err, "failed to parse upload URL")
+	}
+
+	return Host{webURL: web, apiURL: api, uploadURL: upload}, nil
+}
+
+// NewEnterpriseHost creates a Host for a GitHub Enterprise Server instance, deriving
+// the API and upload URLs from the instance's web URL
+func NewEnterpriseHost(webURL string) (Host, error) {
+	web := strings.TrimSuffix(webURL, "/")
+	return NewHost(web+"/", web+"/api/v3/", web+"/api/uploads/")
+}
+
+// repoURL returns the web (and HTTPS clone) URL for a repository
+func (h Host) repoURL(owner string, name string) string {
+	return fmt.Sprintf("%s%s/%s", h.webBase(), owner, name)
+}
+
+// pullURL returns the web URL for a pull request
+func (h Host) pullURL(owner string, name string, number int) string {
+	return fmt.Sprintf("%s/pull/%d", h.repoURL(owner, name), number)
+}
+
+// configureClient points a GitHub API client at this host
+func (h Host) configureClient(client *github.Client) {
+	if h.apiURL != nil {
+		client.BaseURL = h.apiURL
+	}
+	if h.uploadURL != nil {
+		client.UploadURL = h.uploadURL
+	}
+}
+
+// hostname returns the host name of the web URL, used for SSH remotes
+func (h Host) hostname() string {
+	if h.webURL == nil {
+		return "github.com"
+	}
+	return h.webURL.Hostname()
+}
+
+func (h Host) webBase() string {
+	if h.webURL == nil {
+		return defaultWebURL
+	}
+	return h.webURL.String()
+}
+
+// parseBaseURL parses a URL, ensuring it has a trailing slash as required by go-github
+func parseBaseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("URL %q must be absolute", rawURL)
+	}
+
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+
+	return u, nil
+}
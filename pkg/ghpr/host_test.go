@@ -0,0 +1,36 @@
+package ghpr
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultHost(t *testing.T) {
+	host := Host{}
+
+	assert.Equal(t, "https://github.com/shteou/go-ghpr", host.repoURL("shteou", "go-ghpr"))
+	assert.Equal(t, "https://github.com/shteou/go-ghpr/pull/1", host.pullURL("shteou", "go-ghpr", 1))
+}
+
+func TestEnterpriseHost(t *testing.T) {
+	// Given an enterprise host
+	host, err := NewEnterpriseHost("https://github.example.com")
+	assert.Nil(t, err)
+
+	// Then repository and PR URLs are on the enterprise instance
+	assert.Equal(t, "https://github.example.com/shteou/go-ghpr", host.repoURL("shteou", "go-ghpr"))
+	assert.Equal(t, "https://github.example.com/shteou/go-ghpr/pull/1", host.pullURL("shteou", "go-ghpr", 1))
+
+	// And the API client targets the enterprise API
+	client := github.NewClient(nil)
+	host.configureClient(client)
+	assert.Equal(t, "https://github.example.com/api/v3/", client.BaseURL.String())
+	assert.Equal(t, "https://github.example.com/api/uploads/", client.UploadURL.String())
+}
+
+func TestInvalidHost(t *testing.T) {
+	_, err := NewHost("github.example.com", "https://github.example.com/api/v3/", "https://github.example.com/api/uploads/")
+	assert.NotNil(t, err)
+}
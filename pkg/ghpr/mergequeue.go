@@ -0,0 +1,169 @@
+package ghpr
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/pkg/errors"
+)
+
+// MergeQueueRemovedError is returned by WaitForMergeQueue when the PR leaves the merge queue
+// without being merged, e.g. because its checks failed against the queue's merge group
+type MergeQueueRemovedError struct {
+	// Reason is GitHub's explanation for removing the PR, if any
+	Reason string
+}
+
+func (e *MergeQueueRemovedError) Error() string {
+	if e.Reason == "" {
+		return "PR was removed from the merge queue"
+	}
+	return fmt.Sprintf("PR was removed from the merge queue: %s", e.Reason)
+}
+
+const mergeQueueStatusQuery = `query($id: ID!) {
+	node(id: $id) {
+		... on PullRequest {
+			state
+			mergeCommit { oid }
+			mergeQueueEntry { state enqueuedAt }
+			timelineItems(last: 1, itemTypes: [REMOVED_FROM_MERGE_QUEUE_EVENT]) {
+				nodes { ... on RemovedFromMergeQueueEvent { reason createdAt } }
+			}
+		}
+	}
+}`
+
+type mergeQueueStatus struct {
+	Node struct {
+		State       string
+		MergeCommit *struct {
+			Oid string
+		}
+		MergeQueueEntry *struct {
+			State      string
+			EnqueuedAt time.Time
+		}
+		TimelineItems struct {
+			Nodes []struct {
+				Reason    string
+				CreatedAt time.Time
+			}
+		}
+	}
+}
+
+// EnqueueMerge adds the PR to the target branch's merge queue, for branches where GitHub
+// rejects merging the PR directly. The queue creates the merge commit, so use
+// WaitForMergeQueue to wait for it rather than calling Merge. If PRSha is known, the
+// PR is only enqueued if its head is still at that commit
+func (p *PR) EnqueueMerge(ctx context.Context) error {
+	nodeID, err := p.graphQLID(ctx)
+	if err != nil {
+		return err
+	}
+
+	variables := map[string]interface{}{"id": nodeID}
+	if p.PRSha != "" {
+		variables["sha"] = p.PRSha
+	}
+
+	result := struct {
+		EnqueuePullRequest struct {
+			MergeQueueEntry struct {
+				EnqueuedAt time.Time
+			}
+		}
+	}{}
+	err = graphQL(ctx, p.ghClient,
+		`mutation($id: ID!, $sha: GitObjectID) {
+			enqueuePullRequest(input: {pullRequestId: $id, expectedHeadOid: $sha}) { mergeQueueEntry { enqueuedAt } }
+		}`,
+		variables, &result)
+	if err != nil {
+		return errors.Wrap(err, "failed to add PR to merge queue")
+	}
+
+	// Recorded in GitHub's time, to recognise when this entry is removed from the queue
+	p.enqueuedAt = result.EnqueuePullRequest.MergeQueueEntry.EnqueuedAt
+	return nil
+}
+
+// WaitForMergeQueue polls for the PR to leave the merge queue with exponential backoff.
+// Once the queue merges the PR, MergedSha is populated so WaitForMergeChecks can be used
+// as after Merge. If the PR is removed from the queue without being merged, a
+// MergeQueueRemovedError is returned with GitHub's reason. For a PR enqueued by another
+// process, a removal is only recognised once the PR has been seen in the queue
+func (p *PR) WaitForMergeQueue(ctx context.Context, backoffStrategy BackoffStrategy) error {
+	nodeID, err := p.graphQLID(ctx)
+	if err != nil {
+		return err
+	}
+
+	b := &backoff.Backoff{
+		Min:    backoffStrategy.MinPollTime,
+		Max:    backoffStrategy.MaxPollTime,
+		Factor: float64(backoffStrategy.PollBackoffFactor),
+		Jitter: true,
+	}
+
+	for {
+		status := mergeQueueStatus{}
+		err := graphQL(ctx, p.ghClient, mergeQueueStatusQuery, map[string]interface{}{"id": nodeID}, &status)
+		if err != nil {
+			return errors.Wrap(err, "failed to retrieve merge queue status of PR")
+		}
+
+		done, err := p.leftMergeQueue(status)
+		if done {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.New("timed out waiting for PR to leave the merge queue")
+		case <-time.After(b.Duration()):
+		}
+	}
+}
+
+// leftMergeQueue reports whether the PR has left the merge queue, returning an error if it
+// left without being merged
+func (p *PR) leftMergeQueue(status mergeQueueStatus) (bool, error) {
+	pr := status.Node
+
+	if pr.State == "MERGED" && pr.MergeCommit != nil {
+		p.MergedSha = pr.MergeCommit.Oid
+		return true, nil
+	}
+
+	if pr.State == "CLOSED" {
+		return true, &MergeQueueRemovedError{Reason: "PR was closed"}
+	}
+
+	if pr.MergeQueueEntry != nil {
+		// Keep the latest entry's time, e.g. for a PR enqueued by an earlier process
+		if pr.MergeQueueEntry.EnqueuedAt.After(p.enqueuedAt) {
+			p.enqueuedAt = pr.MergeQueueEntry.EnqueuedAt
+		}
+		return false, nil
+	}
+
+	// The PR has no queue entry but isn't merged yet. Only treat it as removed once
+	// there is a removal event since it was enqueued, as the entry is also briefly
+	// absent while the queue merges the PR. Until the PR has been seen in the queue,
+	// any removal event may predate the current entry, so none are matched
+	if p.enqueuedAt.IsZero() {
+		return false, nil
+	}
+
+	for _, event := range pr.TimelineItems.Nodes {
+		if !event.CreatedAt.Before(p.enqueuedAt) {
+			return true, &MergeQueueRemovedError{Reason: event.Reason}
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,119 @@
+package ghpr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func mergeQueuePR(t *testing.T, statuses ...string) (*PR, *[]graphQLRequest) {
+	requests := []graphQLRequest{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		request := graphQLRequest{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+		requests = append(requests, request)
+
+		if len(requests) == 1 {
+			fmt.Fprint(w, `{"data": {"enqueuePullRequest": {"mergeQueueEntry": {"enqueuedAt": "2022-01-01T12:00:00Z"}}}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"data": {"node": %s}}`, statuses[len(requests)-2])
+	})
+
+	repo := newRepo("test", "user", memfs.New(), &mockGoGit{})
+	pr := newPR(NewChange(repo, "test", Credentials{}, dummyFunc), testGitHubClient(t, mux))
+	pr.Number, pr.nodeID, pr.PRSha = 7, "PR_abc", "abc"
+
+	return &pr, &requests
+}
+
+var testMergeQueueBackoff = BackoffStrategy{MinPollTime: time.Millisecond, MaxPollTime: time.Millisecond, PollBackoffFactor: 1}
+
+func TestPRMergeQueueMerged(t *testing.T) {
+	// Given a PR which is merged by the queue after a poll
+	pr, requests := mergeQueuePR(t,
+		`{"state": "OPEN", "mergeQueueEntry": {"state": "AWAITING_CHECKS"}, "timelineItems": {"nodes": []}}`,
+		`{"state": "MERGED", "mergeCommit": {"oid": "def"}, "timelineItems": {"nodes": []}}`)
+
+	// When I enqueue the PR and wait for it to leave the queue
+	assert.Nil(t, pr.EnqueueMerge(context.Background()))
+	err := pr.WaitForMergeQueue(context.Background(), testMergeQueueBackoff)
+
+	// Then the PR was enqueued at its expected head
+	assert.Contains(t, (*requests)[0].Query, "enqueuePullRequest")
+	assert.Equal(t, map[string]interface{}{"id": "PR_abc", "sha": "abc"}, (*requests)[0].Variables)
+
+	// And the merge commit is recorded
+	assert.Nil(t, err)
+	assert.Equal(t, "def", pr.MergedSha)
+}
+
+func TestPRMergeQueueRemoved(t *testing.T) {
+	// Given a PR which is removed from the queue, having been removed once before
+	pr, _ := mergeQueuePR(t,
+		`{"state": "OPEN", "timelineItems": {"nodes": [{"reason": "earlier failure", "createdAt": "2022-01-01T11:00:00Z"}]}}`,
+		`{"state": "OPEN", "timelineItems": {"nodes": [{"reason": "Required status check failed", "createdAt": "2022-01-01T12:05:00Z"}]}}`)
+
+	// When I enqueue the PR and wait for it to leave the queue
+	assert.Nil(t, pr.EnqueueMerge(context.Background()))
+	err := pr.WaitForMergeQueue(context.Background(), testMergeQueueBackoff)
+
+	// Then the reason for the latest removal is returned
+	removedErr, ok := err.(*MergeQueueRemovedError)
+	assert.True(t, ok)
+	assert.Equal(t, "Required status check failed", removedErr.Reason)
+	assert.Equal(t, "", pr.MergedSha)
+}
+
+func resumedMergeQueuePR(t *testing.T, statuses ...string) *PR {
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"data": {"node": %s}}`, statuses[polls])
+		polls++
+	})
+
+	repo := newRepo("test", "user", memfs.New(), &mockGoGit{})
+	pr := newPR(NewChange(repo, "test", Credentials{}, dummyFunc), testGitHubClient(t, mux))
+	pr.Number, pr.nodeID = 7, "PR_abc"
+
+	return &pr
+}
+
+func TestPRMergeQueueResumedIgnoresEarlierRemovals(t *testing.T) {
+	earlierRemoval := `{"nodes": [{"reason": "earlier failure", "createdAt": "2022-01-01T11:00:00Z"}]}`
+
+	// Given a PR enqueued by an earlier process, which was removed from the queue once before
+	pr := resumedMergeQueuePR(t,
+		`{"state": "OPEN", "mergeQueueEntry": {"state": "QUEUED", "enqueuedAt": "2022-01-01T12:00:00Z"}, "timelineItems": `+earlierRemoval+`}`,
+		`{"state": "OPEN", "timelineItems": `+earlierRemoval+`}`,
+		`{"state": "MERGED", "mergeCommit": {"oid": "def"}, "timelineItems": `+earlierRemoval+`}`)
+
+	// When I wait for it to leave the queue
+	err := pr.WaitForMergeQueue(context.Background(), testMergeQueueBackoff)
+
+	// Then the earlier removal is not reported while the queue merges the PR
+	assert.Nil(t, err)
+	assert.Equal(t, "def", pr.MergedSha)
+}
+
+func TestPRMergeQueueResumedNeverSeenQueued(t *testing.T) {
+	// Given a PR whose queue entry has not been observed, with an earlier removal
+	pr := resumedMergeQueuePR(t,
+		`{"state": "OPEN", "timelineItems": {"nodes": [{"reason": "earlier failure", "createdAt": "2022-01-01T11:00:00Z"}]}}`,
+		`{"state": "MERGED", "mergeCommit": {"oid": "def"}, "timelineItems": {"nodes": []}}`)
+
+	// When I wait for it to leave the queue
+	err := pr.WaitForMergeQueue(context.Background(), testMergeQueueBackoff)
+
+	// Then the earlier removal is not mistaken for the current entry's
+	assert.Nil(t, err)
+	assert.Equal(t, "def", pr.MergedSha)
+}
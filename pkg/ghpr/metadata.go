@@ -0,0 +1,86 @@
+package ghpr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// Metadata is applied to a PR when it is created or upserted
+type Metadata struct {
+	Labels    []string
+	Assignees []string
+	// Reviewers are the logins of users requested to review the PR
+	Reviewers []string
+	// TeamReviewers are the slugs of teams requested to review the PR
+	TeamReviewers []string
+	// Milestone is the number of the milestone the PR is added to, if not zero
+	Milestone int
+}
+
+// MetadataFailure records a piece of metadata which could not be applied to a PR
+type MetadataFailure struct {
+	// Field is one of labels, assignees, reviewers or milestone
+	Field string
+	Err   error
+}
+
+// MetadataError is returned when a PR was created or updated, but some of its Metadata
+// could not be applied. Every piece of metadata is attempted, so Failures lists each
+// one which failed
+type MetadataError struct {
+	Number   int
+	Failures []MetadataFailure
+}
+
+func (e *MetadataError) Error() string {
+	failures := []string{}
+	for _, failure := range e.Failures {
+		failures = append(failures, fmt.Sprintf("%s: %s", failure.Field, failure.Err))
+	}
+	return fmt.Sprintf("failed to apply metadata to PR #%d (%s)", e.Number, strings.Join(failures, "; "))
+}
+
+// applyMetadata applies the PR's Metadata via the Issues and Reviewers APIs, returning a
+// MetadataError if any of it could not be applied
+func (p *PR) applyMetadata(ctx context.Context) error {
+	owner, name, m := p.change.repo.Owner, p.change.repo.Name, p.Metadata
+	failures := []MetadataFailure{}
+
+	if len(m.Labels) > 0 {
+		_, _, err := p.ghClient.Issues.AddLabelsToIssue(ctx, owner, name, p.Number, m.Labels)
+		if err != nil {
+			failures = append(failures, MetadataFailure{Field: "labels", Err: err})
+		}
+	}
+
+	if len(m.Assignees) > 0 {
+		_, _, err := p.ghClient.Issues.AddAssignees(ctx, owner, name, p.Number, m.Assignees)
+		if err != nil {
+			failures = append(failures, MetadataFailure{Field: "assignees", Err: err})
+		}
+	}
+
+	if len(m.Reviewers) > 0 || len(m.TeamReviewers) > 0 {
+		_, _, err := p.ghClient.PullRequests.RequestReviewers(ctx, owner, name, p.Number,
+			github.ReviewersRequest{Reviewers: m.Reviewers, TeamReviewers: m.TeamReviewers})
+		if err != nil {
+			failures = append(failures, MetadataFailure{Field: "reviewers", Err: err})
+		}
+	}
+
+	if m.Milestone != 0 {
+		_, _, err := p.ghClient.Issues.Edit(ctx, owner, name, p.Number, &github.IssueRequest{Milestone: &m.Milestone})
+		if err != nil {
+			failures = append(failures, MetadataFailure{Field: "milestone", Err: err})
+		}
+	}
+
+	if len(failures) > 0 {
+		return &MetadataError{Number: p.Number, Failures: failures}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package ghpr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPRCreateAppliesMetadata(t *testing.T) {
+	// Given GitHub accepts the PR and its metadata
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/user/pulls", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		fmt.Fprint(w, `{"number": 7, "head": {"sha": "abc"}}`)
+	})
+
+	requests := map[string]map[string]interface{}{}
+	record := func(response string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var body interface{}
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+			requests[r.URL.Path] = map[string]interface{}{"method": r.Method, "body": body}
+			fmt.Fprint(w, response)
+		}
+	}
+	mux.HandleFunc("/repos/test/user/issues/7/labels", record(`[]`))
+	mux.HandleFunc("/repos/test/user/issues/7/assignees", record(`{}`))
+	mux.HandleFunc("/repos/test/user/pulls/7/requested_reviewers", record(`{}`))
+	mux.HandleFunc("/repos/test/user/issues/7", record(`{}`))
+
+	repo := newRepo("test", "user", memfs.New(), &mockGoGit{})
+	pr := newPR(NewChange(repo, "test", Credentials{}, dummyFunc), testGitHubClient(t, mux))
+	pr.Metadata = Metadata{
+		Labels:        []string{"automated"},
+		Assignees:     []string{"octocat"},
+		Reviewers:     []string{"hubot"},
+		TeamReviewers: []string{"platform"},
+		Milestone:     3,
+	}
+
+	// When I create the PR
+	err := pr.Create(context.Background(), "main", "title", "body")
+
+	// Then each piece of metadata is applied
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"automated"}, requests["/repos/test/user/issues/7/labels"]["body"])
+	assert.Equal(t, map[string]interface{}{"assignees": []interface{}{"octocat"}}, requests["/repos/test/user/issues/7/assignees"]["body"])
+	assert.Equal(t, map[string]interface{}{"reviewers": []interface{}{"hubot"}, "team_reviewers": []interface{}{"platform"}},
+		requests["/repos/test/user/pulls/7/requested_reviewers"]["body"])
+	assert.Equal(t, "PATCH", requests["/repos/test/user/issues/7"]["method"])
+	assert.Equal(t, map[string]interface{}{"milestone": float64(3)}, requests["/repos/test/user/issues/7"]["body"])
+}
+
+func TestPRCreatePartialMetadataFailure(t *testing.T) {
+	// Given GitHub rejects the requested reviewers
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/user/pulls", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 7, "head": {"sha": "abc"}}`)
+	})
+	mux.HandleFunc("/repos/test/user/issues/7/labels", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/test/user/pulls/7/requested_reviewers", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"message": "Reviews may only be requested from collaborators"}`)
+	})
+
+	repo := newRepo("test", "user", memfs.New(), &mockGoGit{})
+	pr := newPR(NewChange(repo, "test", Credentials{}, dummyFunc), testGitHubClient(t, mux))
+	pr.Metadata = Metadata{Labels: []string{"automated"}, Reviewers: []string{"stranger"}}
+
+	// When I create the PR
+	err := pr.Create(context.Background(), "main", "title", "body")
+
+	// Then the PR is created
+	assert.Equal(t, 7, pr.Number)
+
+	// And only the failed metadata is reported
+	metadataErr, ok := err.(*MetadataError)
+	assert.True(t, ok)
+	assert.Equal(t, 7, metadataErr.Number)
+	assert.Len(t, metadataErr.Failures, 1)
+	assert.Equal(t, "reviewers", metadataErr.Failures[0].Field)
+	assert.Contains(t, err.Error(), "Reviews may only be requested from collaborators")
+}
@@ -0,0 +1,142 @@
+package ghpr
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/pkg/errors"
+)
+
+// mirrorLocks holds a mutex per mirror path, so that Repos sharing a mirror
+// do not update it concurrently
+var mirrorLocks sync.Map
+
+// lockMirror locks the mirror at the supplied path, returning a function to unlock it. The
+// mirror is locked both within the process and, via a lock file alongside the mirror,
+// against other processes sharing the cache directory (e.g. overlapping scheduled runs)
+func lockMirror(path string) (func(), error) {
+	lock, _ := mirrorLocks.LoadOrStore(path, &sync.Mutex{})
+	mutex := lock.(*sync.Mutex)
+	mutex.Lock()
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		mutex.Unlock()
+		return nil, errors.Wrap(err, "failed to create mirror cache directory")
+	}
+
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		mutex.Unlock()
+		return nil, errors.Wrap(err, "failed to open mirror lock file")
+	}
+
+	err = lockFile(f)
+	if err != nil {
+		f.Close()
+		mutex.Unlock()
+		return nil, errors.Wrap(err, "failed to lock mirror")
+	}
+
+	return func() {
+		_ = unlockFile(f)
+		f.Close()
+		mutex.Unlock()
+	}, nil
+}
+
+// requireGit checks that the git binary is installed, as go-git shells out to it to
+// clone from a mirror on disk
+func requireGit() error {
+	_, err := exec.LookPath("git")
+	if err != nil {
+		return errors.New("mirror cache requires the git binary to be installed and on the PATH")
+	}
+	return nil
+}
+
+// mirrorPath returns the location of a repository's mirror within the cache directory
+func mirrorPath(cacheDir string, host Host, owner string, name string) string {
+	return filepath.Join(cacheDir, host.hostname(), owner, name+".git")
+}
+
+// updateMirror creates or incrementally fetches a bare mirror of the remote repository
+func updateMirror(ctx context.Context, path string, url string, auth transport.AuthMethod) error {
+	mirror, err := git.PlainOpen(path)
+	if err == git.ErrRepositoryNotExists {
+		mirror, err = initMirror(path, url)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to open mirror")
+	}
+
+	remote, err := mirror.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve mirror remote")
+	}
+
+	err = remote.FetchContext(ctx, &git.FetchOptions{Auth: auth, Force: true, Tags: git.AllTags})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return errors.Wrap(err, "failed to fetch into mirror")
+	}
+
+	// Point the mirror's HEAD at the remote's default branch, so clones from the
+	// mirror check out the same branch as clones from the remote
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return errors.Wrap(err, "failed to list remote references")
+	}
+
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			err = mirror.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, ref.Target()))
+			if err != nil {
+				return errors.Wrap(err, "failed to set mirror HEAD")
+			}
+		}
+	}
+
+	return nil
+}
+
+// initMirror creates an empty bare repository which fetches every branch of the remote
+// repository to a branch of the same name
+func initMirror(path string, url string) (*git.Repository, error) {
+	mirror, err := git.PlainInit(path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = mirror.CreateRemote(&config.RemoteConfig{
+		Name:  git.DefaultRemoteName,
+		URLs:  []string{url},
+		Fetch: []config.RefSpec{"+refs/heads/*:refs/heads/*"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mirror, nil
+}
+
+// pointOriginAt replaces the URL of the origin remote, e.g. so that a repository cloned
+// from a mirror pushes to the real remote repository
+func pointOriginAt(repo *git.Repository, url string) error {
+	err := repo.DeleteRemote(git.DefaultRemoteName)
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{url},
+	})
+	return err
+}
@@ -0,0 +1,173 @@
+package ghpr
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorPath(t *testing.T) {
+	assert.Equal(t, filepath.Join("cache", "github.com", "shteou", "go-ghpr.git"),
+		mirrorPath("cache", Host{}, "shteou", "go-ghpr"))
+}
+
+func TestUpdateMirrorFetchesIncrementally(t *testing.T) {
+	// Given a remote repository and an empty cache
+	originPath := mockMonorepo(t)
+	cacheDir, clean := temporalDir()
+	defer clean()
+	mirror := mirrorPath(cacheDir, Host{}, "shteou", "go-ghpr")
+
+	// When I update the mirror
+	err := updateMirror(context.Background(), mirror, originPath, nil)
+	assert.Nil(t, err)
+
+	// And a new commit is made on the remote
+	origin, err := git.PlainOpen(originPath)
+	assert.Nil(t, err)
+	w, err := origin.Worktree()
+	assert.Nil(t, err)
+	_, _, err = updateDeployment(w)
+	assert.Nil(t, err)
+	_, err = w.Commit("second commit!", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test.test"}})
+	assert.Nil(t, err)
+
+	// And I update the mirror again
+	err = updateMirror(context.Background(), mirror, originPath, nil)
+	assert.Nil(t, err)
+
+	// Then the mirror contains the new commit
+	originHead, err := origin.Head()
+	assert.Nil(t, err)
+	mirrorRepo, err := git.PlainOpen(mirror)
+	assert.Nil(t, err)
+	mirrorBranch, err := mirrorRepo.Reference(originHead.Name(), true)
+	assert.Nil(t, err)
+	assert.Equal(t, originHead.Hash(), mirrorBranch.Hash())
+
+	// And a clone from the mirror can be pointed back at the remote
+	clone, err := git.Clone(memory.NewStorage(), memfs.New(), &git.CloneOptions{
+		URL: mirror, ReferenceName: originHead.Name()})
+	assert.Nil(t, err)
+	assert.Nil(t, pointOriginAt(clone, "https://github.com/shteou/go-ghpr"))
+
+	remote, err := clone.Remote(git.DefaultRemoteName)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://github.com/shteou/go-ghpr"}, remote.Config().URLs)
+}
+
+func TestLockMirror(t *testing.T) {
+	dir, clean := temporalDir()
+	defer clean()
+	mirror := filepath.Join(dir, "github.com", "shteou", "go-ghpr.git")
+
+	unlock, err := lockMirror(mirror)
+	assert.Nil(t, err)
+
+	locked := make(chan bool)
+	go func() {
+		unlockOther, err := lockMirror(mirror)
+		assert.Nil(t, err)
+		locked <- true
+		unlockOther()
+	}()
+
+	// The second lock on the same mirror waits for the first to be released
+	select {
+	case <-locked:
+		t.Fatal("mirror was locked twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlock()
+	assert.True(t, <-locked)
+}
+
+// localGitAuth clones from a repository on disk rather than from GitHub
+type localGitAuth struct {
+	path string
+}
+
+func (a localGitAuth) remoteURL(host Host, owner string, name string) string {
+	return a.path
+}
+
+func (a localGitAuth) authMethod(creds Credentials) (transport.AuthMethod, error) {
+	return nil, nil
+}
+
+func TestCloneWithMirrorCache(t *testing.T) {
+	// Given a remote repository and an empty cache
+	originPath := mockMonorepo(t)
+	cacheDir, clean := temporalDir()
+	defer clean()
+	workDir, cleanWorkDir := temporalDir()
+	defer cleanWorkDir()
+
+	clone := func() Repo {
+		r := newRepo("shteou", "go-ghpr", osfs.New(workDir), realGoGit{},
+			WithGitAuth(localGitAuth{originPath}), WithMirrorCache(cacheDir))
+		assert.Nil(t, r.CloneContext(context.Background(), Credentials{}))
+		return r
+	}
+
+	// When I clone the repository
+	r := clone()
+
+	// Then it is cloned via the mirror
+	_, err := git.PlainOpen(mirrorPath(cacheDir, Host{}, "shteou", "go-ghpr"))
+	assert.Nil(t, err)
+
+	// And changes are pushed to the remote repository
+	remote, err := r.repo.Remote(git.DefaultRemoteName)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{originPath}, remote.Config().URLs)
+
+	branch, err := r.BaseBranch()
+	assert.Nil(t, err)
+	assert.Equal(t, "master", branch)
+
+	// And when a new commit is made on the remote and I clone again
+	origin, err := git.PlainOpen(originPath)
+	assert.Nil(t, err)
+	w, err := origin.Worktree()
+	assert.Nil(t, err)
+	_, _, err = updateDeployment(w)
+	assert.Nil(t, err)
+	latest, err := w.Commit("second commit!", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test.test"}})
+	assert.Nil(t, err)
+
+	r = clone()
+
+	// Then the clone contains the new commit
+	head, err := r.repo.Head()
+	assert.Nil(t, err)
+	assert.Equal(t, latest, head.Hash())
+}
+
+func TestCloneWithMirrorCacheRequiresGit(t *testing.T) {
+	// Given the git binary is not installed
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", "")
+
+	cacheDir, clean := temporalDir()
+	defer clean()
+	r := newRepo("shteou", "go-ghpr", memfs.New(), new(mockGoGit), WithMirrorCache(cacheDir))
+
+	// When I clone the repository via a mirror
+	err := r.CloneContext(context.Background(), Credentials{})
+
+	// Then a clear error is returned
+	assert.EqualError(t, err, "mirror cache requires the git binary to be installed and on the PATH")
+}
@@ -3,6 +3,7 @@ package ghpr
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/go-github/github"
@@ -17,36 +18,168 @@ type PR struct {
 	ghClient  *github.Client
 	PRSha     string
 	MergedSha string
+	// Metadata, if set, is applied to the PR by Create and Upsert
+	Metadata Metadata
+	// Draft opens the PR as a draft when created, so that reviewers are not notified until
+	// it is marked ready for review
+	Draft      bool
+	nodeID     string
+	enqueuedAt time.Time
+}
+
+// newPullRequest adds the draft flag, which the GitHub client predates, to a NewPullRequest
+type newPullRequest struct {
+	*github.NewPullRequest
+	Draft bool `json:"draft,omitempty"`
 }
 
 // NewPR creates a new PR object. The supplied context may be used
-// over the course of the PR object's lifetime
+// over the course of the PR object's lifetime. The API client targets
+// the Host of the Change's Repo
 func NewPR(ctx context.Context, change Change, creds Credentials) PR {
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: creds.Token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
+	return newPR(change, newGitHubClient(ctx, change.repo.host, creds))
+}
 
-	client := github.NewClient(tc)
+// NewPRFromNumber creates a PR object for an existing PR in GitHub, e.g. one raised by an
+// earlier process. No clone of the repository is required. The supplied context may be used
+// over the course of the PR object's lifetime
+func NewPRFromNumber(ctx context.Context, owner string, name string, number int, creds Credentials, opts ...RepoOption) (PR, error) {
+	repo := uncloned(owner, name, opts...)
+	pr := newPR(NewMultiCommitChange(repo, "", creds), newGitHubClient(ctx, repo.host, creds))
+
+	ghPR, _, err := pr.ghClient.PullRequests.Get(ctx, owner, name, number)
+	if err != nil {
+		return PR{}, errors.Wrap(err, fmt.Sprintf("failed to retrieve PR #%d", number))
+	}
+
+	pr.adopt(ghPR)
+	return pr, nil
+}
+
+// NewPRFromBranch creates a PR object for the most recent existing PR in GitHub raised from the
+// supplied head branch. No clone of the repository is required. For a PR raised from a fork,
+// supply WithForkOwner. The supplied context may be used over the course of the PR object's lifetime
+func NewPRFromBranch(ctx context.Context, owner string, name string, branch string, creds Credentials, opts ...RepoOption) (PR, error) {
+	repo := uncloned(owner, name, opts...)
+	pr := newPR(NewMultiCommitChange(repo, branch, creds), newGitHubClient(ctx, repo.host, creds))
+
+	prs, _, err := pr.ghClient.PullRequests.List(ctx, owner, name,
+		&github.PullRequestListOptions{
+			State: "all",
+			Head:  fmt.Sprintf("%s:%s", repo.headOwner(), branch)})
+	if err != nil {
+		return PR{}, errors.Wrap(err, fmt.Sprintf("failed to list PRs for branch %s", branch))
+	}
+
+	if len(prs) == 0 {
+		return PR{}, fmt.Errorf("no PR found for branch %s", branch)
+	}
 
-	return newPR(change, client)
+	pr.adopt(prs[0])
+	return pr, nil
 }
 
-// Create a PR in Github from the Change's source branch to the supplied target branch
+// Create a PR in Github from the Change's source branch to the supplied target branch.
+// If the target branch is empty, the Repo's base branch is targeted. The PR's Metadata is
+// then applied, returning a MetadataError if any of it fails, even though the PR was created
 func (p *PR) Create(ctx context.Context, targetBranch string, title string, body string) error {
-	pr, _, err := p.ghClient.PullRequests.Create(ctx,
-		p.change.repo.Owner, p.change.repo.Name,
-		&github.NewPullRequest{
-			Title: &title,
-			Head:  &p.change.Branch,
-			Base:  &targetBranch,
-			Body:  &body})
+	targetBranch, err := p.targetBranch(targetBranch)
+	if err != nil {
+		return err
+	}
+
+	head := p.head()
+	req, err := p.ghClient.NewRequest("POST",
+		fmt.Sprintf("repos/%s/%s/pulls", p.change.repo.Owner, p.change.repo.Name),
+		&newPullRequest{
+			NewPullRequest: &github.NewPullRequest{
+				Title: &title,
+				Head:  &head,
+				Base:  &targetBranch,
+				Body:  &body},
+			Draft: p.Draft})
+	if err != nil {
+		return errors.Wrap(err, "failed to create PR")
+	}
+
+	pr := &github.PullRequest{}
+	_, err = p.ghClient.Do(ctx, req, pr)
 	if err != nil {
 		return errors.Wrap(err, "failed to create PR")
 	}
 
 	p.Number = *pr.Number
 	p.PRSha = *pr.Head.SHA
+	p.nodeID = pr.GetNodeID()
+
+	return p.applyMetadata(ctx)
+}
+
+// Upsert creates a PR in GitHub from the Change's source branch to the supplied target branch,
+// or, if an open PR already exists for that branch, adopts it and updates its title and body.
+// This allows a workflow to be safely re-run after a partial failure. If the target branch is
+// empty, the Repo's base branch is targeted. The PR's Metadata is applied in either case
+func (p *PR) Upsert(ctx context.Context, targetBranch string, title string, body string) error {
+	targetBranch, err := p.targetBranch(targetBranch)
+	if err != nil {
+		return err
+	}
+
+	existing, err := p.findOpenPR(ctx, targetBranch)
+	if err != nil {
+		return errors.Wrap(err, "failed to search for existing PR")
+	}
+
+	if existing == nil {
+		return p.Create(ctx, targetBranch, title, body)
+	}
+
+	pr, _, err := p.ghClient.PullRequests.Edit(ctx,
+		p.change.repo.Owner, p.change.repo.Name, existing.GetNumber(),
+		&github.PullRequest{
+			Title: &title,
+			Body:  &body})
+	if err != nil {
+		return errors.Wrap(err, "failed to update existing PR")
+	}
+
+	p.adopt(pr)
+
+	return p.applyMetadata(ctx)
+}
+
+// Refresh recreates the PR's Change on top of the latest target branch and force updates
+// the PR's source branch, so that a PR which has gone stale or conflicts can be checked
+// and merged. PRSha is updated to the new head of the source branch
+func (p *PR) Refresh(ctx context.Context) error {
+	err := p.change.RebuildContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	head, err := p.change.repo.repo.Head()
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve HEAD ref of repository")
+	}
+
+	p.PRSha = head.Hash().String()
+	return nil
+}
+
+// MarkReadyForReview transitions a draft PR to ready for review, requesting reviews from
+// its reviewers and code owners, e.g. once WaitForPRChecks has succeeded
+func (p *PR) MarkReadyForReview(ctx context.Context) error {
+	nodeID, err := p.graphQLID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = graphQL(ctx, p.ghClient,
+		`mutation($id: ID!) { markPullRequestReadyForReview(input: {pullRequestId: $id}) { clientMutationId } }`,
+		map[string]interface{}{"id": nodeID}, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to mark PR as ready for review")
+	}
 
 	return nil
 }
@@ -77,6 +210,50 @@ func (p *PR) Merge(ctx context.Context, mergeMethod string) error {
 	return nil
 }
 
+// EnableAutoMerge enables GitHub's auto-merge for the PR using the supplied mergeMethod (one
+// of merge, rebase or squash), so that GitHub merges it once its requirements (e.g. reviews
+// and required checks) are satisfied, without the process waiting for them. Auto-merge must
+// be allowed in the repository's settings
+func (p *PR) EnableAutoMerge(ctx context.Context, mergeMethod string) error {
+	method, err := graphQLMergeMethod(mergeMethod)
+	if err != nil {
+		return err
+	}
+
+	nodeID, err := p.graphQLID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = graphQL(ctx, p.ghClient,
+		`mutation($id: ID!, $method: PullRequestMergeMethod!) {
+			enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: $method}) { clientMutationId }
+		}`,
+		map[string]interface{}{"id": nodeID, "method": method}, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to enable auto-merge for PR")
+	}
+
+	return nil
+}
+
+// DisableAutoMerge disables GitHub's auto-merge for the PR
+func (p *PR) DisableAutoMerge(ctx context.Context) error {
+	nodeID, err := p.graphQLID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = graphQL(ctx, p.ghClient,
+		`mutation($id: ID!) { disablePullRequestAutoMerge(input: {pullRequestId: $id}) { clientMutationId } }`,
+		map[string]interface{}{"id": nodeID}, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to disable auto-merge for PR")
+	}
+
+	return nil
+}
+
 // WaitForMergeChecks polls for GitHub action/status results on the merged commit of a PR (a reference on
 // the target branch) with exponential backoff
 func (p *PR) WaitForMergeChecks(ctx context.Context, checks []Check, backoffStrategy BackoffStrategy) error {
@@ -124,7 +301,99 @@ func (p *PR) URL() (string, error) {
 		return "", errors.New("pull request doesn't have a valid PR number (was PR creation successful?)")
 	}
 
-	return fmt.Sprintf("https://github.com/%s/%s/pull/%d", p.change.repo.Owner, p.change.repo.Name, p.Number), nil
+	return p.change.repo.host.pullURL(p.change.repo.Owner, p.change.repo.Name, p.Number), nil
+}
+
+// graphQLID returns the PR's GraphQL node ID, retrieving the PR if it is not yet known
+func (p *PR) graphQLID(ctx context.Context) (string, error) {
+	if p.nodeID != "" {
+		return p.nodeID, nil
+	}
+
+	if p.Number == 0 {
+		return "", errors.New("pull request doesn't have a valid PR number (was PR creation successful?)")
+	}
+
+	pr, err := p.GetGithubPR(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to retrieve GitHub PR")
+	}
+
+	p.nodeID = pr.GetNodeID()
+	return p.nodeID, nil
+}
+
+// graphQLMergeMethod maps a REST API merge method onto the GraphQL PullRequestMergeMethod
+func graphQLMergeMethod(mergeMethod string) (string, error) {
+	switch mergeMethod {
+	case "merge", "rebase", "squash":
+		return strings.ToUpper(mergeMethod), nil
+	default:
+		return "", fmt.Errorf("unknown merge method %q, must be one of merge, rebase or squash", mergeMethod)
+	}
+}
+
+// targetBranch defaults an empty target branch to the Repo's base branch
+func (p *PR) targetBranch(targetBranch string) (string, error) {
+	if targetBranch != "" {
+		return targetBranch, nil
+	}
+
+	base, err := p.change.repo.BaseBranch()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to determine target branch")
+	}
+	return base, nil
+}
+
+// head returns the PR's head, qualified with the owner when raised from a fork
+func (p *PR) head() string {
+	if p.change.repo.forkOwner != "" {
+		return fmt.Sprintf("%s:%s", p.change.repo.forkOwner, p.change.Branch)
+	}
+	return p.change.Branch
+}
+
+// findOpenPR returns the open PR from the Change's source branch to the target branch, or
+// nil if there is none
+func (p *PR) findOpenPR(ctx context.Context, targetBranch string) (*github.PullRequest, error) {
+	prs, _, err := p.ghClient.PullRequests.List(ctx,
+		p.change.repo.Owner, p.change.repo.Name,
+		&github.PullRequestListOptions{
+			State: "open",
+			Head:  fmt.Sprintf("%s:%s", p.change.repo.headOwner(), p.change.Branch),
+			Base:  targetBranch})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(prs) == 0 {
+		return nil, nil
+	}
+
+	return prs[0], nil
+}
+
+// adopt populates the PR from an existing GitHub PR
+func (p *PR) adopt(pr *github.PullRequest) {
+	p.Number = pr.GetNumber()
+	p.PRSha = pr.GetHead().GetSHA()
+	p.nodeID = pr.GetNodeID()
+	if pr.GetMerged() {
+		p.MergedSha = pr.GetMergeCommitSHA()
+	}
+	if ref := pr.GetHead().GetRef(); ref != "" {
+		p.change.Branch = ref
+	}
+}
+
+func newGitHubClient(ctx context.Context, host Host, creds Credentials) *github.Client {
+	tc := oauth2.NewClient(ctx, creds.tokenSource())
+
+	client := github.NewClient(tc)
+	host.configureClient(client)
+
+	return client
 }
 
 func newPR(change Change, client *github.Client) PR {
@@ -148,6 +417,31 @@ func statusSuccessful(targetStatus string, statuses []*github.RepoStatus) (strin
 	return "", errors.New("Could not find target context in commit status list")
 }
 
+// checkRunSuccessful maps the latest check run with the given name onto a status-like
+// state of "success", "failure" or "pending"
+func checkRunSuccessful(targetCheck string, checkRuns []*github.CheckRun) (string, error) {
+	for _, checkRun := range checkRuns {
+		if checkRun.GetName() != targetCheck {
+			continue
+		}
+
+		if checkRun.GetStatus() != "completed" {
+			return "pending", nil
+		}
+
+		switch checkRun.GetConclusion() {
+		case "success", "neutral", "skipped":
+			return "success", nil
+		case "failure", "cancelled", "timed_out", "action_required", "stale":
+			return "failure", nil
+		default:
+			return "pending", nil
+		}
+	}
+
+	return "", errors.New("Could not find target check run in check run list")
+}
+
 func (p *PR) waitForChecks(ctx context.Context, shaRef string, checks []Check, backoffStrategy BackoffStrategy) error {
 	b := &backoff.Backoff{
 		Min:    backoffStrategy.MinPollTime,
@@ -168,10 +462,6 @@ func (p *PR) waitForChecks(ctx context.Context, shaRef string, checks []Check, b
 		}
 	}
 
-	if len(targetActions) > 0 {
-		return errors.New("Unsupported check type, check not yet implemented")
-	}
-
 	for {
 		statuses, _, err := p.ghClient.Repositories.ListStatuses(ctx,
 			p.change.repo.Owner, p.change.repo.Name,
@@ -197,7 +487,28 @@ func (p *PR) waitForChecks(ctx context.Context, shaRef string, checks []Check, b
 			}
 		}
 
-		if statusesSuccessful == len(targetStatuses) {
+		checkRuns, err := p.listCheckRuns(ctx, shaRef, targetActions)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed listing check runs while waiting for %s", shaRef))
+		}
+
+		actionsSuccessful := 0
+		for _, action := range targetActions {
+			result, err := checkRunSuccessful(action, checkRuns)
+			if err != nil {
+				// If a check run is not found yet, wait for next poll
+				break
+			}
+
+			if result == "success" {
+				actionsSuccessful += 1
+				continue
+			} else if result == "failure" {
+				return fmt.Errorf("target action check (%s) is in a failed state, aborting", action)
+			}
+		}
+
+		if statusesSuccessful == len(targetStatuses) && actionsSuccessful == len(targetActions) {
 			return nil
 		}
 
@@ -208,3 +519,26 @@ func (p *PR) waitForChecks(ctx context.Context, shaRef string, checks []Check, b
 		}
 	}
 }
+
+// listCheckRuns fetches all check runs (e.g. GitHub Actions jobs) for a given ref from the Checks API
+func (p *PR) listCheckRuns(ctx context.Context, shaRef string, targetActions []string) ([]*github.CheckRun, error) {
+	if len(targetActions) == 0 {
+		return nil, nil
+	}
+
+	checkRuns := []*github.CheckRun{}
+	opts := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		result, resp, err := p.ghClient.Checks.ListCheckRunsForRef(ctx,
+			p.change.repo.Owner, p.change.repo.Name, shaRef, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		checkRuns = append(checkRuns, result.CheckRuns...)
+		if resp.NextPage == 0 {
+			return checkRuns, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
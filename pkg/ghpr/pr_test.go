@@ -1,11 +1,19 @@
 package ghpr
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/go-github/github"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -32,3 +40,381 @@ func TestPRUrl(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "https://github.com/test/user/pull/1", url)
 }
+
+func checkRun(name string, status string, conclusion string) *github.CheckRun {
+	return &github.CheckRun{Name: &name, Status: &status, Conclusion: &conclusion}
+}
+
+func TestCheckRunSuccessful(t *testing.T) {
+	runs := []*github.CheckRun{
+		checkRun("build", "completed", "success"),
+		checkRun("lint", "completed", "skipped"),
+		checkRun("test", "completed", "timed_out"),
+		checkRun("deploy", "in_progress", ""),
+	}
+
+	result, err := checkRunSuccessful("build", runs)
+	assert.Nil(t, err)
+	assert.Equal(t, "success", result)
+
+	result, err = checkRunSuccessful("lint", runs)
+	assert.Nil(t, err)
+	assert.Equal(t, "success", result)
+
+	result, err = checkRunSuccessful("test", runs)
+	assert.Nil(t, err)
+	assert.Equal(t, "failure", result)
+
+	result, err = checkRunSuccessful("deploy", runs)
+	assert.Nil(t, err)
+	assert.Equal(t, "pending", result)
+}
+
+func TestCheckRunNotFound(t *testing.T) {
+	_, err := checkRunSuccessful("missing", []*github.CheckRun{checkRun("build", "completed", "success")})
+	assert.NotNil(t, err)
+}
+
+// testGitHubClient returns a GitHub client which sends requests to the supplied handler
+func testGitHubClient(t *testing.T, mux *http.ServeMux) *github.Client {
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.Nil(t, err)
+	client.BaseURL = baseURL
+
+	return client
+}
+
+var testBackoff = BackoffStrategy{MinPollTime: time.Millisecond, MaxPollTime: 10 * time.Millisecond, PollBackoffFactor: 2}
+
+func TestWaitForChecks(t *testing.T) {
+	// Given a successful status and an action, on the second page of check runs, which
+	// succeeds on the second poll
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/user/commits/abc/statuses", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"context": "Semantic Pull Request", "state": "success"}]`)
+	})
+	polls := 0
+	mux.HandleFunc("/repos/test/user/commits/abc/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") != "2" {
+			polls++
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=2>; rel="next"`, r.URL.Path))
+			fmt.Fprint(w, `{"total_count": 2, "check_runs": [{"name": "lint", "status": "completed", "conclusion": "success"}]}`)
+			return
+		}
+
+		if polls == 1 {
+			fmt.Fprint(w, `{"total_count": 2, "check_runs": [{"name": "build", "status": "in_progress"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"total_count": 2, "check_runs": [{"name": "build", "status": "completed", "conclusion": "success"}]}`)
+	})
+
+	repo := newRepo("test", "user", memfs.New(), &mockGoGit{})
+	pr := newPR(NewChange(repo, "test", Credentials{}, dummyFunc), testGitHubClient(t, mux))
+	pr.PRSha = "abc"
+
+	// When I wait for the checks
+	err := pr.WaitForPRChecks(context.Background(), []Check{
+		{Name: "Semantic Pull Request", CheckType: "status"},
+		{Name: "build", CheckType: "action"}}, testBackoff)
+
+	// Then the checks pass once the action has completed
+	assert.Nil(t, err)
+	assert.Equal(t, 2, polls)
+}
+
+func TestWaitForChecksFailedAction(t *testing.T) {
+	// Given an action which has failed
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/user/commits/abc/statuses", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/test/user/commits/abc/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count": 1, "check_runs": [{"name": "build", "status": "completed", "conclusion": "cancelled"}]}`)
+	})
+
+	repo := newRepo("test", "user", memfs.New(), &mockGoGit{})
+	pr := newPR(NewChange(repo, "test", Credentials{}, dummyFunc), testGitHubClient(t, mux))
+	pr.MergedSha = "abc"
+
+	// When I wait for the checks
+	err := pr.WaitForMergeChecks(context.Background(), []Check{{Name: "build", CheckType: "action"}}, testBackoff)
+
+	// Then the failure is returned
+	assert.EqualError(t, err, "target action check (build) is in a failed state, aborting")
+}
+
+// testHost returns a Host whose API is served by the supplied mux, for PRs which create their own client
+func testHost(t *testing.T, mux *http.ServeMux) Host {
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	host, err := NewHost(server.URL+"/", server.URL+"/", server.URL+"/")
+	assert.Nil(t, err)
+
+	return host
+}
+
+func TestNewPRFromNumber(t *testing.T) {
+	// Given a merged PR exists
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/user/pulls/7", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		fmt.Fprint(w, `{"number": 7, "node_id": "PR_7", "merged": true, "merge_commit_sha": "def", "head": {"ref": "feature", "sha": "abc"}}`)
+	})
+
+	// When I create a PR object from its number
+	pr, err := NewPRFromNumber(context.Background(), "test", "user", 7, Credentials{}, WithHost(testHost(t, mux)))
+
+	// Then the existing PR is adopted
+	assert.Nil(t, err)
+	assert.Equal(t, 7, pr.Number)
+	assert.Equal(t, "abc", pr.PRSha)
+	assert.Equal(t, "def", pr.MergedSha)
+	assert.Equal(t, "PR_7", pr.nodeID)
+	assert.Equal(t, "feature", pr.change.Branch)
+}
+
+func TestNewPRFromNumberNotFound(t *testing.T) {
+	// Given the PR does not exist
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/user/pulls/7", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	})
+
+	// When I create a PR object from its number
+	_, err := NewPRFromNumber(context.Background(), "test", "user", 7, Credentials{}, WithHost(testHost(t, mux)))
+
+	// Then an error is returned
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to retrieve PR #7")
+}
+
+func TestNewPRFromBranch(t *testing.T) {
+	// Given a PR exists for the branch
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/user/pulls", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "test:feature", r.URL.Query().Get("head"))
+		assert.Equal(t, "all", r.URL.Query().Get("state"))
+		fmt.Fprint(w, `[{"number": 7, "head": {"ref": "feature", "sha": "abc"}}]`)
+	})
+
+	// When I create a PR object from the branch
+	pr, err := NewPRFromBranch(context.Background(), "test", "user", "feature", Credentials{}, WithHost(testHost(t, mux)))
+
+	// Then the existing PR is adopted
+	assert.Nil(t, err)
+	assert.Equal(t, 7, pr.Number)
+	assert.Equal(t, "abc", pr.PRSha)
+	assert.Equal(t, "feature", pr.change.Branch)
+}
+
+func TestNewPRFromForkBranch(t *testing.T) {
+	// Given a PR exists for a branch of a fork
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/user/pulls", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "bot:feature", r.URL.Query().Get("head"))
+		fmt.Fprint(w, `[{"number": 7, "head": {"ref": "feature", "sha": "abc"}}]`)
+	})
+
+	// When I create a PR object from the fork's branch
+	pr, err := NewPRFromBranch(context.Background(), "test", "user", "feature", Credentials{},
+		WithHost(testHost(t, mux)), WithForkOwner("bot"))
+
+	// Then the existing PR is adopted
+	assert.Nil(t, err)
+	assert.Equal(t, 7, pr.Number)
+	assert.Equal(t, "bot:feature", pr.head())
+}
+
+func TestNewPRFromBranchNotFound(t *testing.T) {
+	// Given no PR exists for the branch
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/user/pulls", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+
+	// When I create a PR object from the branch
+	_, err := NewPRFromBranch(context.Background(), "test", "user", "feature", Credentials{}, WithHost(testHost(t, mux)))
+
+	// Then an error is returned
+	assert.EqualError(t, err, "no PR found for branch feature")
+}
+
+func TestPRUpsertUpdatesExistingPR(t *testing.T) {
+	// Given an open PR already exists for the branch
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/user/pulls", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "test:test", r.URL.Query().Get("head"))
+		assert.Equal(t, "main", r.URL.Query().Get("base"))
+		fmt.Fprint(w, `[{"number": 7, "head": {"sha": "abc"}}]`)
+	})
+	mux.HandleFunc("/repos/test/user/pulls/7", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PATCH", r.Method)
+		body := map[string]interface{}{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]interface{}{"title": "new title", "body": "new body"}, body)
+		fmt.Fprint(w, `{"number": 7, "title": "new title", "head": {"sha": "def"}}`)
+	})
+
+	repo := newRepo("test", "user", memfs.New(), &mockGoGit{})
+	change := NewChange(repo, "test", Credentials{}, dummyFunc)
+	pr := newPR(change, testGitHubClient(t, mux))
+
+	// When I upsert the PR
+	err := pr.Upsert(context.Background(), "main", "new title", "new body")
+
+	// Then the existing PR is adopted and updated
+	assert.Nil(t, err)
+	assert.Equal(t, 7, pr.Number)
+	assert.Equal(t, "def", pr.PRSha)
+}
+
+func TestPRUpsertCreatesPR(t *testing.T) {
+	// Given no open PR exists for the branch
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/user/pulls", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+
+		assert.Equal(t, "POST", r.Method)
+		body := map[string]interface{}{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "title", body["title"])
+		assert.Equal(t, "body", body["body"])
+		assert.Equal(t, "test", body["head"])
+		assert.Equal(t, "main", body["base"])
+		fmt.Fprint(w, `{"number": 8, "head": {"sha": "abc"}}`)
+	})
+
+	repo := newRepo("test", "user", memfs.New(), &mockGoGit{})
+	pr := newPR(NewChange(repo, "test", Credentials{}, dummyFunc), testGitHubClient(t, mux))
+
+	// When I upsert the PR
+	err := pr.Upsert(context.Background(), "main", "title", "body")
+
+	// Then a new PR is created
+	assert.Nil(t, err)
+	assert.Equal(t, 8, pr.Number)
+	assert.Equal(t, "abc", pr.PRSha)
+}
+
+func TestPRAdoptMergedPR(t *testing.T) {
+	repo := newRepo("test", "user", memfs.New(), &mockGoGit{})
+	pr := newPR(NewChange(repo, "", Credentials{}, nil), nil)
+
+	// When I adopt a merged GitHub PR
+	number, merged, ref, headSha, mergeSha := 3, true, "feature", "abc", "def"
+	pr.adopt(&github.PullRequest{
+		Number:         &number,
+		Merged:         &merged,
+		MergeCommitSHA: &mergeSha,
+		Head:           &github.PullRequestBranch{Ref: &ref, SHA: &headSha}})
+
+	// Then the PR and merge details are populated
+	assert.Equal(t, 3, pr.Number)
+	assert.Equal(t, "abc", pr.PRSha)
+	assert.Equal(t, "def", pr.MergedSha)
+	assert.Equal(t, "feature", pr.change.Branch)
+}
+
+func TestPRCreateDraft(t *testing.T) {
+	// Given GitHub accepts the PR
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/user/pulls", func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, true, body["draft"])
+		assert.Equal(t, "test", body["head"])
+		fmt.Fprint(w, `{"number": 7, "node_id": "PR_abc", "draft": true, "head": {"sha": "abc"}}`)
+	})
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		request := graphQLRequest{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.Contains(t, request.Query, "markPullRequestReadyForReview")
+		assert.Equal(t, "PR_abc", request.Variables["id"])
+		fmt.Fprint(w, `{"data": {"markPullRequestReadyForReview": {"clientMutationId": null}}}`)
+	})
+
+	repo := newRepo("test", "user", memfs.New(), &mockGoGit{})
+	pr := newPR(NewChange(repo, "test", Credentials{}, dummyFunc), testGitHubClient(t, mux))
+	pr.Draft = true
+
+	// When I create the PR as a draft
+	err := pr.Create(context.Background(), "main", "title", "body")
+	assert.Nil(t, err)
+	assert.Equal(t, 7, pr.Number)
+
+	// Then it can be marked ready for review
+	err = pr.MarkReadyForReview(context.Background())
+	assert.Nil(t, err)
+}
+
+func TestPRMarkReadyForReviewRetrievesNodeID(t *testing.T) {
+	// Given an existing PR whose node ID is not known
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/test/user/pulls/7", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number": 7, "node_id": "PR_def"}`)
+	})
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		request := graphQLRequest{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.Equal(t, "PR_def", request.Variables["id"])
+		fmt.Fprint(w, `{"data": {}}`)
+	})
+
+	repo := newRepo("test", "user", memfs.New(), &mockGoGit{})
+	pr := newPR(NewChange(repo, "test", Credentials{}, dummyFunc), testGitHubClient(t, mux))
+	pr.Number = 7
+
+	// When I mark it ready for review
+	err := pr.MarkReadyForReview(context.Background())
+
+	// Then the node ID is looked up first
+	assert.Nil(t, err)
+}
+
+func TestPREnableAutoMerge(t *testing.T) {
+	// Given an open PR
+	requests := []graphQLRequest{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		request := graphQLRequest{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+		requests = append(requests, request)
+		fmt.Fprint(w, `{"data": {}}`)
+	})
+
+	repo := newRepo("test", "user", memfs.New(), &mockGoGit{})
+	pr := newPR(NewChange(repo, "test", Credentials{}, dummyFunc), testGitHubClient(t, mux))
+	pr.Number, pr.nodeID = 7, "PR_abc"
+
+	// When I enable and then disable auto-merge
+	assert.Nil(t, pr.EnableAutoMerge(context.Background(), "squash"))
+	assert.Nil(t, pr.DisableAutoMerge(context.Background()))
+
+	// Then the corresponding mutations are sent for the PR
+	assert.Len(t, requests, 2)
+	assert.Contains(t, requests[0].Query, "enablePullRequestAutoMerge")
+	assert.Equal(t, map[string]interface{}{"id": "PR_abc", "method": "SQUASH"}, requests[0].Variables)
+	assert.Contains(t, requests[1].Query, "disablePullRequestAutoMerge")
+	assert.Equal(t, map[string]interface{}{"id": "PR_abc"}, requests[1].Variables)
+}
+
+func TestPREnableAutoMergeUnknownMethod(t *testing.T) {
+	repo := newRepo("test", "user", memfs.New(), &mockGoGit{})
+	pr := newPR(NewChange(repo, "test", Credentials{}, dummyFunc), nil)
+
+	// When I enable auto-merge with an unknown merge method, then an error is returned
+	err := pr.EnableAutoMerge(context.Background(), "fast-forward")
+	assert.EqualError(t, err, `unknown merge method "fast-forward", must be one of merge, rebase or squash`)
+}
@@ -1,15 +1,22 @@
 package ghpr
 
 import (
+	"context"
 	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/go-git/go-billy/v5/util"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage"
 	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/pkg/errors"
 )
 
@@ -22,18 +29,181 @@ type Repo struct {
 	filesystem billy.Filesystem
 	git        goGit
 	repo       *git.Repository
+	// The GitHub instance hosting the repository
+	host Host
+	// How clones and pushes authenticate with the remote repository
+	gitAuth GitAuth
+	// The number of commits to clone, or 0 for the full history
+	depth int
+	// The branch to check out as the base for changes, or empty for the default branch
+	baseBranch string
+	// The commit checked out when the repository was cloned or opened
+	baseCommit plumbing.Hash
+	// Whether to fetch only the base branch
+	singleBranch bool
+	// Paths to materialise in the worktree, or empty to check out every file
+	sparsePaths []string
+	// Directory containing bare mirrors used as the source of clones, or empty to clone directly
+	mirrorCacheDir string
+	// Whether git objects and references are held in memory rather than in .git
+	inMemory bool
+	// Whether Close should leave the temporary directory in place
+	keep bool
+	// The owner of the fork changes are pushed to, or empty to push to the repository itself
+	forkOwner string
+}
+
+// RepoOption configures optional behaviour of a Repo
+type RepoOption func(r *Repo)
+
+// WithHost sets the GitHub instance hosting the repository, e.g. a GitHub
+// Enterprise Server. Defaults to github.com
+func WithHost(host Host) RepoOption {
+	return func(r *Repo) {
+		r.host = host
+	}
+}
+
+// WithGitAuth sets how clones and pushes authenticate with the remote repository,
+// e.g. SSHKeyAuth for a deploy key. Defaults to HTTPSAuth
+func WithGitAuth(auth GitAuth) RepoOption {
+	return func(r *Repo) {
+		r.gitAuth = auth
+	}
+}
+
+// WithCloneDepth sets the number of commits of history to clone, or 0 to clone
+// the full history. Defaults to 1, i.e. a shallow clone
+func WithCloneDepth(depth int) RepoOption {
+	return func(r *Repo) {
+		r.depth = depth
+	}
+}
+
+// WithBaseBranch sets the branch which is checked out after cloning, and from which
+// changes are branched. Defaults to the remote's default branch
+func WithBaseBranch(branch string) RepoOption {
+	return func(r *Repo) {
+		r.baseBranch = branch
+	}
+}
+
+// WithSingleBranch fetches only the base branch when cloning
+func WithSingleBranch() RepoOption {
+	return func(r *Repo) {
+		r.singleBranch = true
+	}
+}
+
+// WithSparseCheckout only materialises files within the supplied directories (e.g. "deploy/")
+// or matching the supplied glob patterns in the worktree. Changes outside of these paths
+// are not possible, and update functions should stage files individually rather than
+// adding the whole worktree
+func WithSparseCheckout(patterns ...string) RepoOption {
+	return func(r *Repo) {
+		r.sparsePaths = patterns
+	}
+}
+
+// WithMirrorCache clones via a bare mirror of the repository kept in the supplied
+// directory. The mirror is created on first use and fetched incrementally afterwards,
+// so repeated clones only download new objects from GitHub. Pushes are still made
+// directly to the remote repository. Cloning from the mirror requires the git binary
+// to be installed, and CloneContext returns an error if it is not found
+func WithMirrorCache(dir string) RepoOption {
+	return func(r *Repo) {
+		r.mirrorCacheDir = dir
+	}
+}
+
+// WithForkOwner sets the account owning the fork which PRs are raised from, e.g. so that
+// NewPRFromBranch finds a PR raised from a fork by an earlier process. To push changes to
+// a fork of a cloned repository, use Repo.Fork instead
+func WithForkOwner(owner string) RepoOption {
+	return func(r *Repo) {
+		r.forkOwner = owner
+	}
+}
+
+// WithWorkDir sets the directory in which the temporary directory housing the repository
+// is created, e.g. os.TempDir() or a scratch volume. Defaults to the current working directory
+func WithWorkDir(dir string) RepoOption {
+	return func(r *Repo) {
+		r.rootFilesystem = osfs.New(dir)
+	}
 }
 
 // NewRepo creates a new Repo object with the supplied parameters
-func NewRepo(owner string, name string) Repo {
-	return newRepo(owner, name, osfs.New("."), realGoGit{})
+func NewRepo(owner string, name string, opts ...RepoOption) Repo {
+	return newRepo(owner, name, osfs.New("."), realGoGit{}, opts...)
+}
+
+// NewMemoryRepo creates a new Repo object which is cloned entirely into memory, for
+// environments without a writable filesystem. It otherwise behaves as NewRepo
+func NewMemoryRepo(owner string, name string, opts ...RepoOption) Repo {
+	r := newRepo(owner, name, memfs.New(), realGoGit{}, opts...)
+	r.inMemory = true
+	return r
+}
+
+// OpenRepo creates a Repo from an existing local checkout, e.g. a CI workspace, rather
+// than cloning. The owner and name are inferred from the URL of the origin remote. The
+// checkout is not cloned again and Close leaves it in place
+func OpenRepo(path string, opts ...RepoOption) (Repo, error) {
+	repo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return Repo{}, errors.Wrap(err, fmt.Sprintf("failed to open repository at %s", path))
+	}
+
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return Repo{}, errors.Wrap(err, "failed to retrieve origin remote")
+	}
+
+	owner, name, err := parseRemoteURL(remote.Config().URLs[0])
+	if err != nil {
+		return Repo{}, err
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return Repo{}, errors.Wrap(err, "failed to fetch Worktree for repository")
+	}
+
+	r := newRepo(owner, name, w.Filesystem, realGoGit{}, opts...)
+	r.filesystem = w.Filesystem
+	r.repo = repo
+	r.keep = true
+
+	err = r.recordBaseBranch()
+	if err != nil {
+		return Repo{}, err
+	}
+
+	return r, nil
 }
 
 // Clone the remote repository to a temporary directory
 func (r *Repo) Clone(creds Credentials) error {
-	url := fmt.Sprintf("https://github.com/" + r.Owner + "/" + r.Name)
+	return r.CloneContext(context.Background(), creds)
+}
+
+// CloneContext clones the remote repository to a temporary directory. The clone
+// is aborted if the supplied context is cancelled
+func (r *Repo) CloneContext(ctx context.Context, creds Credentials) error {
+	if r.mirrorCacheDir != "" {
+		err := requireGit()
+		if err != nil {
+			return err
+		}
+	}
 
-	auth := http.BasicAuth{Username: creds.Username, Password: creds.Token}
+	url := r.gitAuth.remoteURL(r.host, r.Owner, r.Name)
+
+	auth, err := r.gitAuth.authMethod(creds)
+	if err != nil {
+		return errors.Wrap(err, "failed to configure git authentication")
+	}
 
 	tempDir, err := util.TempDir(r.rootFilesystem, ".", "repo_")
 	if err != nil {
@@ -45,29 +215,117 @@ func (r *Repo) Clone(creds Credentials) error {
 		return errors.Wrap(err, fmt.Sprintf("failed to change directory to %s", tempDir))
 	}
 
-	storageWorkTree, err := r.filesystem.Chroot(".git")
+	storer, err := r.newStorer()
 	if err != nil {
-		return errors.Wrap(err, "failed to change directory to .git")
+		return err
 	}
 
-	// Pass a defafult LRU object cache, as per git.PlainClone's implementation
-	r.repo, err = r.git.Clone(
-		filesystem.NewStorage(storageWorkTree, cache.NewObjectLRUDefault()),
+	cloneURL, cloneAuth := url, auth
+	if r.mirrorCacheDir != "" {
+		mirror := mirrorPath(r.mirrorCacheDir, r.host, r.Owner, r.Name)
+		unlock, err := lockMirror(mirror)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		err = updateMirror(ctx, mirror, url, auth)
+		if err != nil {
+			return errors.Wrap(err, "failed to update mirror cache")
+		}
+		cloneURL, cloneAuth = mirror, nil
+	}
+
+	r.repo, err = r.git.CloneContext(ctx,
+		storer,
 		r.filesystem,
-		&git.CloneOptions{
-			Depth: 1,
-			URL:   url,
-			Auth:  &auth})
+		r.cloneOptions(cloneURL, cloneAuth))
 
 	if err != nil {
 		return errors.Wrap(err, "failed to clone remote repository")
 	}
 
+	err = r.recordBaseBranch()
+	if err != nil {
+		return err
+	}
+
+	if r.mirrorCacheDir != "" {
+		err = pointOriginAt(r.repo, url)
+		if err != nil {
+			return errors.Wrap(err, "failed to set origin remote")
+		}
+	}
+
+	if len(r.sparsePaths) > 0 {
+		err = sparseCheckout(r.repo, r.sparsePaths)
+		if err != nil {
+			return errors.Wrap(err, "failed to perform sparse checkout")
+		}
+	}
+
 	return nil
 }
 
-// Close removes the contents of the temporary directory
+// BaseBranch returns the branch from which changes are made, i.e. the configured
+// base branch or, once cloned, the remote's default branch
+func (r *Repo) BaseBranch() (string, error) {
+	if r.baseBranch == "" {
+		return "", errors.New("base branch is unknown until the repository is cloned")
+	}
+
+	return r.baseBranch, nil
+}
+
+// recordBaseBranch records the branch checked out by a clone as the base branch, if none
+// was configured, along with the commit checked out. This must happen before a Change
+// moves HEAD onto its own branch
+func (r *Repo) recordBaseBranch() error {
+	head, err := r.repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve HEAD ref of repository")
+	}
+
+	// A detached HEAD leaves the base branch unknown, so it must be configured instead
+	if r.baseBranch == "" && head.Type() == plumbing.SymbolicReference && head.Target().IsBranch() {
+		r.baseBranch = head.Target().Short()
+	}
+
+	resolved, err := r.repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		// The repository has no commits yet
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve HEAD of repository")
+	}
+
+	r.baseCommit = resolved.Hash()
+	return nil
+}
+
+// Keep prevents Close from removing the temporary directory, e.g. so that the
+// checkout can be inspected after a failed run. See Path
+func (r *Repo) Keep() {
+	r.keep = true
+}
+
+// Path returns the location of the temporary directory housing the repository, or
+// an empty string if the repository has not been cloned
+func (r *Repo) Path() string {
+	if r.filesystem == nil {
+		return ""
+	}
+	return r.filesystem.Root()
+}
+
+// Close removes the contents of the temporary directory. It is safe to call Close
+// whether or not the repository was cloned successfully, and more than once
 func (r *Repo) Close() error {
+	if r.filesystem == nil || r.keep {
+		return nil
+	}
+
 	err := util.RemoveAll(r.filesystem, ".")
 	if err != nil {
 		return errors.Wrap(err, "failed to clean up temporary directory")
@@ -75,12 +333,81 @@ func (r *Repo) Close() error {
 	return nil
 }
 
-func newRepo(owner string, name string, fs billy.Filesystem, git goGit) Repo {
-	return Repo{
+// newStorer creates the storage for git objects and references, either in memory or
+// in the .git directory of the temporary filesystem
+func (r *Repo) newStorer() (storage.Storer, error) {
+	if r.inMemory {
+		return memory.NewStorage(), nil
+	}
+
+	storageWorkTree, err := r.filesystem.Chroot(".git")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to change directory to .git")
+	}
+
+	// Pass a defafult LRU object cache, as per git.PlainClone's implementation
+	return filesystem.NewStorage(storageWorkTree, cache.NewObjectLRUDefault()), nil
+}
+
+func (r *Repo) cloneOptions(url string, auth transport.AuthMethod) *git.CloneOptions {
+	o := &git.CloneOptions{
+		Depth:        r.depth,
+		URL:          url,
+		Auth:         auth,
+		SingleBranch: r.singleBranch,
+		NoCheckout:   len(r.sparsePaths) > 0,
+	}
+
+	if r.baseBranch != "" {
+		o.ReferenceName = plumbing.NewBranchReferenceName(r.baseBranch)
+	}
+
+	return o
+}
+
+// parseRemoteURL extracts the owner and name of a repository from an HTTPS or SSH remote
+// URL, e.g. https://github.com/shteou/go-ghpr.git or git@github.com:shteou/go-ghpr.git
+func parseRemoteURL(remoteURL string) (string, string, error) {
+	repoPath := remoteURL
+	if strings.Contains(remoteURL, "://") {
+		u, err := url.Parse(remoteURL)
+		if err != nil {
+			return "", "", errors.Wrap(err, fmt.Sprintf("failed to parse remote URL %s", remoteURL))
+		}
+		repoPath = u.Path
+	} else if i := strings.Index(remoteURL, ":"); i >= 0 {
+		repoPath = remoteURL[i+1:]
+	}
+
+	repoPath = strings.TrimSuffix(strings.TrimSuffix(repoPath, "/"), ".git")
+	parts := strings.Split(strings.Trim(repoPath, "/"), "/")
+	if len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return "", "", fmt.Errorf("failed to determine owner and name from remote URL %s", remoteURL)
+	}
+
+	return parts[len(parts)-2], parts[len(parts)-1], nil
+}
+
+// uncloned returns a Repo which only identifies a repository in GitHub, for PR objects
+// which need no clone of it
+func uncloned(owner string, name string, opts ...RepoOption) Repo {
+	return newRepo(owner, name, nil, nil, opts...)
+}
+
+func newRepo(owner string, name string, fs billy.Filesystem, git goGit, opts ...RepoOption) Repo {
+	r := Repo{
 		Name:           name,
 		Owner:          owner,
 		rootFilesystem: fs,
 		filesystem:     nil,
 		git:            git,
+		gitAuth:        HTTPSAuth(),
+		depth:          1,
 	}
+
+	for _, opt := range opts {
+		opt(&r)
+	}
+
+	return r
 }
@@ -0,0 +1,188 @@
+package ghpr
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// sshSigNamespace is the namespace git uses for SSH commit signatures
+	sshSigNamespace = "git"
+	// sshSigHashAlgorithm is the hash algorithm applied to the message before SSH signing
+	sshSigHashAlgorithm = "sha512"
+	// sshSigLineLength is the line length of an armored SSH signature, as per ssh-keygen
+	sshSigLineLength = 70
+)
+
+// CommitSigner signs the commits made by Change.Push, e.g. to satisfy branch protection
+// which requires signed commits. See NewGPGSigner and NewSSHSigner
+type CommitSigner interface {
+	sign(message io.Reader) (string, error)
+}
+
+type gpgSigner struct {
+	entity *openpgp.Entity
+}
+
+// NewGPGSigner creates a CommitSigner from an armored OpenPGP private key. The passphrase
+// may be empty if the key is not encrypted
+func NewGPGSigner(armoredKey []byte, passphrase string) (CommitSigner, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(armoredKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read OpenPGP key")
+	}
+	if len(entities) == 0 || entities[0].PrivateKey == nil {
+		return nil, errors.New("no OpenPGP private key found")
+	}
+
+	entity := entities[0]
+	if entity.PrivateKey.Encrypted {
+		err = entity.PrivateKey.Decrypt([]byte(passphrase))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decrypt OpenPGP key")
+		}
+	}
+	for _, subkey := range entity.Subkeys {
+		if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+			err = subkey.PrivateKey.Decrypt([]byte(passphrase))
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to decrypt OpenPGP subkey")
+			}
+		}
+	}
+
+	return gpgSigner{entity: entity}, nil
+}
+
+func (s gpgSigner) sign(message io.Reader) (string, error) {
+	var b bytes.Buffer
+	err := openpgp.ArmoredDetachSign(&b, s.entity, message, nil)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+type sshSigner struct {
+	signer ssh.Signer
+}
+
+// NewSSHSigner creates a CommitSigner from a PEM encoded SSH private key. The passphrase
+// may be empty if the key is not encrypted
+func NewSSHSigner(pemBytes []byte, passphrase string) (CommitSigner, error) {
+	var signer ssh.Signer
+	var err error
+	if passphrase == "" {
+		signer, err = ssh.ParsePrivateKey(pemBytes)
+	} else {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse SSH private key")
+	}
+
+	return sshSigner{signer: signer}, nil
+}
+
+// sign creates an armored SSH signature as described in OpenSSH's PROTOCOL.sshsig
+func (s sshSigner) sign(message io.Reader) (string, error) {
+	contents, err := ioutil.ReadAll(message)
+	if err != nil {
+		return "", err
+	}
+	digest := sha512.Sum512(contents)
+
+	signedData := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          string
+	}{sshSigNamespace, "", sshSigHashAlgorithm, string(digest[:])})...)
+
+	var signature *ssh.Signature
+	if algorithmSigner, ok := s.signer.(ssh.AlgorithmSigner); ok && s.signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// SSH signatures must not use SHA-1, which is the default for RSA keys
+		signature, err = algorithmSigner.SignWithAlgorithm(rand.Reader, signedData, ssh.SigAlgoRSASHA2512)
+	} else {
+		signature, err = s.signer.Sign(rand.Reader, signedData)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	blob := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Version       uint32
+		PublicKey     string
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     string
+	}{1, string(s.signer.PublicKey().Marshal()), sshSigNamespace, "", sshSigHashAlgorithm, string(ssh.Marshal(signature))})...)
+
+	return armorSSHSignature(blob), nil
+}
+
+func armorSSHSignature(blob []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(blob)
+
+	var b bytes.Buffer
+	b.WriteString("-----BEGIN SSH SIGNATURE-----\n")
+	for len(encoded) > sshSigLineLength {
+		b.WriteString(encoded[:sshSigLineLength] + "\n")
+		encoded = encoded[sshSigLineLength:]
+	}
+	b.WriteString(encoded + "\n")
+	b.WriteString("-----END SSH SIGNATURE-----\n")
+
+	return b.String()
+}
+
+// signHead replaces the commit at HEAD with a signed copy, updating the current branch
+func signHead(repo *git.Repository, signer CommitSigner) error {
+	head, err := repo.Head()
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve HEAD ref of repository")
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve HEAD commit")
+	}
+
+	unsigned := &plumbing.MemoryObject{}
+	err = commit.EncodeWithoutSignature(unsigned)
+	if err != nil {
+		return err
+	}
+	reader, err := unsigned.Reader()
+	if err != nil {
+		return err
+	}
+
+	commit.PGPSignature, err = signer.sign(reader)
+	if err != nil {
+		return errors.Wrap(err, "failed to sign commit")
+	}
+
+	signed := repo.Storer.NewEncodedObject()
+	err = commit.Encode(signed)
+	if err != nil {
+		return err
+	}
+	hash, err := repo.Storer.SetEncodedObject(signed)
+	if err != nil {
+		return errors.Wrap(err, "failed to store signed commit")
+	}
+
+	return repo.Storer.SetReference(plumbing.NewHashReference(head.Name(), hash))
+}
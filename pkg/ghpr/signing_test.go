@@ -0,0 +1,125 @@
+package ghpr
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// pushSignedCommit pushes a single commit signed by the supplied signer, returning the pushed commit
+func pushSignedCommit(t *testing.T, signer CommitSigner) *object.Commit {
+	originPath, originRepo := mockRemoteRepository(t)
+	change := NewChange(clonedRepo(t, originPath), "foo", Credentials{Signer: signer}, commitSomething)
+	assert.Nil(t, change.Push())
+
+	ref, err := originRepo.Reference("refs/heads/foo", true)
+	assert.Nil(t, err)
+	commit, err := originRepo.CommitObject(ref.Hash())
+	assert.Nil(t, err)
+
+	return commit
+}
+
+func TestGPGSignedCommit(t *testing.T) {
+	// Given an OpenPGP key
+	entity, err := openpgp.NewEntity("bot", "", "bot@example.com", nil)
+	assert.Nil(t, err)
+
+	var privateKey bytes.Buffer
+	w, err := armor.Encode(&privateKey, openpgp.PrivateKeyType, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, entity.SerializePrivate(w, nil))
+	assert.Nil(t, w.Close())
+
+	var publicKey bytes.Buffer
+	w, err = armor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, entity.Serialize(w))
+	assert.Nil(t, w.Close())
+
+	signer, err := NewGPGSigner(privateKey.Bytes(), "")
+	assert.Nil(t, err)
+
+	// When I push a signed commit
+	commit := pushSignedCommit(t, signer)
+
+	// Then the commit's signature can be verified
+	_, err = commit.Verify(publicKey.String())
+	assert.Nil(t, err)
+}
+
+func TestSSHSignedCommit(t *testing.T) {
+	// Given an SSH key
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+
+	signer, err := NewSSHSigner(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), "")
+	assert.Nil(t, err)
+
+	// When I push a signed commit
+	commit := pushSignedCommit(t, signer)
+
+	// Then the commit has an SSH signature
+	assert.True(t, strings.HasPrefix(commit.PGPSignature, "-----BEGIN SSH SIGNATURE-----\n"))
+	armored := strings.TrimPrefix(commit.PGPSignature, "-----BEGIN SSH SIGNATURE-----\n")
+	armored = strings.TrimSuffix(armored, "-----END SSH SIGNATURE-----\n")
+	blob, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(armored, "\n", ""))
+	assert.Nil(t, err)
+
+	var sig struct {
+		Version       uint32
+		PublicKey     string
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     string
+	}
+	assert.True(t, bytes.HasPrefix(blob, []byte("SSHSIG")))
+	assert.Nil(t, ssh.Unmarshal(blob[6:], &sig))
+	assert.Equal(t, "git", sig.Namespace)
+
+	// And the signature can be verified against the commit contents
+	publicKey, err := ssh.ParsePublicKey([]byte(sig.PublicKey))
+	assert.Nil(t, err)
+	signature := &ssh.Signature{}
+	assert.Nil(t, ssh.Unmarshal([]byte(sig.Signature), signature))
+
+	encoded := &plumbing.MemoryObject{}
+	assert.Nil(t, commit.EncodeWithoutSignature(encoded))
+	reader, err := encoded.Reader()
+	assert.Nil(t, err)
+	contents, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	digest := sha512.Sum512(contents)
+	signedData := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          string
+	}{"git", "", "sha512", string(digest[:])})...)
+	assert.Nil(t, publicKey.Verify(signedData, signature))
+}
+
+func TestInvalidSigners(t *testing.T) {
+	_, err := NewGPGSigner([]byte("not a key"), "")
+	assert.NotNil(t, err)
+
+	_, err = NewSSHSigner([]byte("not a key"), "")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,119 @@
+package ghpr
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+// sparseCheckout materialises only the files at HEAD which match one of the supplied
+// patterns into the Worktree. The index still records every file, so commits made
+// from it retain the files which were not checked out
+func sparseCheckout(repo *git.Repository, patterns []string) error {
+	head, err := repo.Head()
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve HEAD ref of repository")
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve HEAD commit")
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve HEAD tree")
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch Worktree for cloned repository")
+	}
+
+	idx := &index.Index{Version: 2}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		entry := &index.Entry{
+			Hash: f.Hash,
+			Name: f.Name,
+			Mode: f.Mode,
+			Size: uint32(f.Size),
+		}
+
+		if sparseMatch(patterns, f.Name) {
+			err := writeFile(w.Filesystem, f)
+			if err != nil {
+				return errors.Wrap(err, "failed to check out "+f.Name)
+			}
+
+			info, err := w.Filesystem.Lstat(f.Name)
+			if err != nil {
+				return err
+			}
+			entry.ModifiedAt = info.ModTime()
+		}
+
+		idx.Entries = append(idx.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return repo.Storer.SetIndex(idx)
+}
+
+// sparseMatch reports whether a file path is within one of the supplied directories,
+// or matches one of the supplied glob patterns
+func sparseMatch(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		dir := strings.TrimSuffix(pattern, "/")
+		if name == dir || strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeFile writes a file from the repository to the Worktree filesystem
+func writeFile(fs billy.Filesystem, f *object.File) error {
+	mode, err := f.Mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+
+	from, err := f.Reader()
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+
+	if mode&os.ModeSymlink != 0 {
+		target, err := ioutil.ReadAll(from)
+		if err != nil {
+			return err
+		}
+		return fs.Symlink(string(target), f.Name)
+	}
+
+	to, err := fs.OpenFile(f.Name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer to.Close()
+
+	_, err = io.Copy(to, from)
+	return err
+}
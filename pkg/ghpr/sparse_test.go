@@ -0,0 +1,118 @@
+package ghpr
+
+import (
+	"testing"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockMonorepo creates a remote repository on disk containing files in several directories
+func mockMonorepo(t *testing.T) string {
+	path, clean := temporalDir()
+	t.Cleanup(clean)
+
+	repo, err := git.PlainInit(path, false)
+	assert.Nil(t, err)
+
+	w, err := repo.Worktree()
+	assert.Nil(t, err)
+
+	for _, file := range []string{"deploy/values.yaml", "src/main.go", "README.md"} {
+		assert.Nil(t, util.WriteFile(w.Filesystem, file, []byte(file), 0644))
+		_, err = w.Add(file)
+		assert.Nil(t, err)
+	}
+
+	_, err = w.Commit("first commit!", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test.test"}})
+	assert.Nil(t, err)
+
+	return path
+}
+
+func updateDeployment(w *git.Worktree) (string, *object.Signature, error) {
+	err := util.WriteFile(w.Filesystem, "deploy/values.yaml", []byte("updated"), 0644)
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = w.Add("deploy/values.yaml")
+	if err != nil {
+		return "", nil, err
+	}
+
+	return "update deployment", &object.Signature{Name: "author", Email: "test@currencycloud.com"}, nil
+}
+
+func TestSparseMatch(t *testing.T) {
+	patterns := []string{"deploy/", "*.md"}
+
+	assert.True(t, sparseMatch(patterns, "deploy/values.yaml"))
+	assert.True(t, sparseMatch(patterns, "README.md"))
+	assert.False(t, sparseMatch(patterns, "deployment/values.yaml"))
+	assert.False(t, sparseMatch(patterns, "src/main.go"))
+}
+
+func TestSparseCheckoutPush(t *testing.T) {
+	// Given a sparse clone of a monorepo
+	originPath := mockMonorepo(t)
+	fs := memfs.New()
+	repo, err := git.Clone(memory.NewStorage(), fs, &git.CloneOptions{URL: originPath, NoCheckout: true})
+	assert.Nil(t, err)
+	assert.Nil(t, sparseCheckout(repo, []string{"deploy/"}))
+
+	// Then only the requested directories are materialised
+	_, err = fs.Stat("deploy/values.yaml")
+	assert.Nil(t, err)
+	_, err = fs.Stat("src/main.go")
+	assert.NotNil(t, err)
+
+	// When I push a change within those directories
+	r := newRepo("shteou", "go-ghpr", memfs.New(), newMockGoGit(), WithSparseCheckout("deploy/"))
+	r.repo = repo
+	change := NewChange(r, "foo", Credentials{}, updateDeployment)
+	err = change.Push()
+	assert.Nil(t, err)
+
+	// Then the pushed commit contains the change and retains the files which weren't checked out
+	origin, err := git.PlainOpen(originPath)
+	assert.Nil(t, err)
+	ref, err := origin.Reference("refs/heads/foo", true)
+	assert.Nil(t, err)
+	commit, err := origin.CommitObject(ref.Hash())
+	assert.Nil(t, err)
+
+	file, err := commit.File("deploy/values.yaml")
+	assert.Nil(t, err)
+	contents, err := file.Contents()
+	assert.Nil(t, err)
+	assert.Equal(t, "updated", contents)
+
+	_, err = commit.File("src/main.go")
+	assert.Nil(t, err)
+	_, err = commit.File("README.md")
+	assert.Nil(t, err)
+}
+
+func TestSparseCheckoutDryRun(t *testing.T) {
+	// Given a sparse clone of a monorepo
+	originPath := mockMonorepo(t)
+	repo, err := git.Clone(memory.NewStorage(), memfs.New(), &git.CloneOptions{URL: originPath, NoCheckout: true})
+	assert.Nil(t, err)
+	assert.Nil(t, sparseCheckout(repo, []string{"deploy/"}))
+
+	// When I dry run a change within the checked out directories
+	r := newRepo("shteou", "go-ghpr", memfs.New(), new(mockGoGit), WithSparseCheckout("deploy/"))
+	r.repo = repo
+	change := NewChange(r, "foo", Credentials{}, updateDeployment)
+	diff, err := change.DryRun()
+
+	// Then the files which weren't checked out aren't treated as uncommitted changes
+	assert.Nil(t, err)
+	assert.Len(t, diff.Files, 1)
+	assert.Equal(t, "deploy/values.yaml", diff.Files[0].To)
+}
@@ -1,6 +1,8 @@
 package ghpr
 
 import (
+	"context"
+
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/storage"
@@ -9,13 +11,18 @@ import (
 // goGit provides an interface for to go-git methods in use by this module
 // This is interface is not exported.
 type goGit interface {
-	Clone(s storage.Storer, worktree billy.Filesystem, o *git.CloneOptions) (*git.Repository, error)
+	CloneContext(ctx context.Context, s storage.Storer, worktree billy.Filesystem, o *git.CloneOptions) (*git.Repository, error)
+	PushContext(ctx context.Context, r *git.Repository, o *git.PushOptions) error
 }
 
 // realGoGit is a go-git backed implementation of the GoGit interface
 type realGoGit struct {
 }
 
-func (g realGoGit) Clone(s storage.Storer, worktree billy.Filesystem, o *git.CloneOptions) (*git.Repository, error) {
-	return git.Clone(s, worktree, o)
+func (g realGoGit) CloneContext(ctx context.Context, s storage.Storer, worktree billy.Filesystem, o *git.CloneOptions) (*git.Repository, error) {
+	return git.CloneContext(ctx, s, worktree, o)
+}
+
+func (g realGoGit) PushContext(ctx context.Context, r *git.Repository, o *git.PushOptions) error {
+	return r.PushContext(ctx, o)
 }